@@ -0,0 +1,129 @@
+package credential
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// LoadFromDir 读取目录中的每个 *.json 文件并合并其中的凭证，按 AuthID 去重 (保留先读到的)。
+// 每个文件可以是单个凭证对象，也可以是凭证数组，适合由容器编排系统把每个密钥挂载为单独的文件。
+// 文件按文件名顺序读取；目录不存在、任一文件无法读取或解析时返回错误。
+func LoadFromDir(dir string) ([]ApiCredential, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取凭证目录失败: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", dir)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("列出凭证文件失败: %w", err)
+	}
+
+	var credentials []ApiCredential
+	for _, file := range files {
+		if info, err := os.Stat(file); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取凭证文件 %s 失败: %w", file, err)
+		}
+		creds, err := parseCredentialFile(data)
+		if err != nil {
+			return nil, fmt.Errorf("解析凭证文件 %s 失败: %w", file, err)
+		}
+		credentials = append(credentials, creds...)
+	}
+	return dedupeCredentials(cleanCredentials(credentials)), nil
+}
+
+// parseCredentialFile 解析单个凭证对象或凭证数组，空文件返回空列表
+func parseCredentialFile(data []byte) ([]ApiCredential, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] == '[' {
+		var credentials []ApiCredential
+		err := json.Unmarshal(data, &credentials)
+		return credentials, err
+	}
+	var cred ApiCredential
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return nil, err
+	}
+	return []ApiCredential{cred}, nil
+}
+
+// dedupeCredentials 按 AuthID 去重，保留第一次出现的凭证；缺少 AuthID 的凭证原样保留
+func dedupeCredentials(credentials []ApiCredential) []ApiCredential {
+	seen := make(map[string]bool, len(credentials))
+	unique := credentials[:0]
+	for _, cred := range credentials {
+		if cred.AuthID != "" && seen[cred.AuthID] {
+			log.Printf("警告: 凭证 %s 重复出现，只使用第一次出现的配置。", cred.AuthID)
+			continue
+		}
+		seen[cred.AuthID] = true
+		unique = append(unique, cred)
+	}
+	return unique
+}
+
+// DirSource 在 Base 的凭证之后合并 Dir 目录中的凭证 (见 LoadFromDir)，按 AuthID 去重。
+// 目录中的凭证只读：写回时只把不来自目录的凭证 (包括运行中补充的凭证) 交给 Base 保存。
+type DirSource struct {
+	Dir  string
+	Base Source
+
+	// fromDir 记录只出现在目录中的凭证的 AuthID，Load 时填充
+	fromDir map[string]bool
+}
+
+// Load 实现 Source 接口
+func (s *DirSource) Load() ([]ApiCredential, error) {
+	base, err := s.Base.Load()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := LoadFromDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(base))
+	for _, cred := range base {
+		known[cred.AuthID] = true
+	}
+	s.fromDir = make(map[string]bool)
+	for _, cred := range dir {
+		if !known[cred.AuthID] {
+			s.fromDir[cred.AuthID] = true
+		}
+	}
+	log.Printf("从凭证目录 %s 中读取 %d 组凭证。", s.Dir, len(dir))
+	return dedupeCredentials(append(base, dir...)), nil
+}
+
+// Save 实现 Saver 接口；Base 不支持写回时不做任何事
+func (s *DirSource) Save(credentials []ApiCredential) error {
+	saver, ok := s.Base.(Saver)
+	if !ok {
+		return nil
+	}
+	var kept []ApiCredential
+	for _, cred := range credentials {
+		if !s.fromDir[cred.AuthID] {
+			kept = append(kept, cred)
+		}
+	}
+	return saver.Save(kept)
+}
+
+func (s *DirSource) String() string { return fmt.Sprintf("%s + %s", s.Base, s.Dir) }
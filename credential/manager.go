@@ -0,0 +1,271 @@
+// Package credential 管理 Smarty API 凭证的加载、轮换与保存。
+package credential
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultMaxUsage 是未指定 MaxUsage 的凭证的最大使用次数 (Smarty 免费账号每月 1000 次)
+const DefaultMaxUsage = 1000
+
+// ApiCredential 用于封装AuthID和AuthToken
+type ApiCredential struct {
+	AuthID    string `json:"auth_id"`
+	AuthToken string `json:"auth_token"`
+	// MaxUsage 是该凭证的最大使用次数，不同的 Smarty 套餐额度不同；未指定时为 DefaultMaxUsage
+	MaxUsage int `json:"max_usage,omitempty"`
+}
+
+// Limit 返回凭证的最大使用次数
+func (c ApiCredential) Limit() int {
+	if c.MaxUsage > 0 {
+		return c.MaxUsage
+	}
+	return DefaultMaxUsage
+}
+
+// APIManager 负责管理API密钥。
+// 它只负责每组凭证的 MaxUsage 轮换，不限制整个运行的查询总次数；总次数的上限由 -max-lookups
+// (pipeline 包的 lookupBudget) 在请求凭证之前检查，所有凭证共用，达到后同样触发关闭流程。
+type APIManager struct {
+	credentials []ApiCredential // 存储所有API凭证
+	current     int             // 当前使用的凭证索引
+	usageCount  int             // 当前凭证的使用次数
+	rejected    []ApiCredential // 启动时未通过验证、已移出轮换的凭证
+	used        map[string]bool // 实际发送过查询的凭证 (按 AuthID)，见 MarkUsed
+	mutex       sync.Mutex      // 互斥锁，保证线程安全
+}
+
+// NewAPIManager 创建一个新的API密钥管理器
+func NewAPIManager(credentials []ApiCredential) *APIManager {
+	return &APIManager{
+		credentials: credentials,
+		current:     0,
+		usageCount:  0,
+		used:        make(map[string]bool),
+	}
+}
+
+// GetCredentials 为一次最多包含 addresses 个地址、每个地址最多 perAddress 次查询的请求获取一个可用的API凭证。
+// Smarty 按地址计费，批量请求中的每个地址都计入凭证的使用次数。
+// 它返回的 granted 是当前凭证剩余额度能够容纳的地址数量 (1 到 addresses 之间)，调用方只能发送这么多地址，
+// 因此凭证的使用次数不会超过 Limit()；剩余额度连一个地址都容纳不下的凭证会被跳过。
+// 如果所有凭证均已耗尽，它会暂停并补充新的凭证 (见 additionalCredentials)。
+// 如果没有可以补充的凭证，它会返回 false，示意工作单元应停止工作。
+func (m *APIManager) GetCredentials(addresses, perAddress int) (cred ApiCredential, granted int, ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	perAddress = max(perAddress, 1)
+	for {
+		// 检查是否所有凭证都已用尽
+		if m.current >= len(m.credentials) {
+			slog.Warn("所有可用的API凭证均已耗尽或失效。程序已暂停，正在补充新的凭证。", "credentials", len(m.credentials))
+
+			// 从环境变量、补充凭证文件或用户输入获取新的凭证
+			newCredentials := m.additionalCredentials(1) // 至少请求一组新的
+
+			if len(newCredentials) == 0 {
+				slog.Warn("没有可以补充的新凭证。处理工作将停止。")
+				return ApiCredential{}, 0, false // 这是关键的退出信号
+			}
+
+			// 将新凭证添加到管理器中
+			m.credentials = append(m.credentials, newCredentials...)
+			slog.Info("已成功添加新凭证。程序将继续处理。", "added", len(newCredentials))
+			// m.current 此时正好是新凭证的索引，无需修改
+		}
+
+		// 按当前凭证的剩余额度决定本次请求能发送的地址数量，一个地址都容纳不下时切换到下一个
+		cred = m.credentials[m.current]
+		if granted = min(addresses, (cred.Limit()-m.usageCount)/perAddress); granted > 0 {
+			m.usageCount += granted * perAddress
+			return cred, granted, true
+		}
+		slog.Info("凭证已达到使用上限，正在切换...", "auth_id", cred.AuthID, "usage", m.usageCount, "limit", cred.Limit(), "lookups", perAddress)
+		m.rotate()
+	}
+}
+
+// Release 归还 GetCredentials 为 cred 预留、但实际没有发送的 lookups 次查询。
+// 只有 cred 仍是当前凭证时才归还；凭证已经轮换时不做任何事，多计的次数只会让轮换略微提前，不会超额使用。
+func (m *APIManager) Release(cred ApiCredential, lookups int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if lookups <= 0 || m.current >= len(m.credentials) || m.credentials[m.current].AuthID != cred.AuthID {
+		return
+	}
+	m.usageCount = max(m.usageCount-lookups, 0)
+}
+
+// InvalidateCurrent 标记当前凭证为无效并立即切换到下一个
+func (m *APIManager) InvalidateCurrent() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.current >= len(m.credentials) {
+		return
+	}
+	slog.Warn("凭证失效，正在强制切换...", "auth_id", m.credentials[m.current].AuthID, "usage", m.usageCount)
+	m.rotate()
+}
+
+// rotate 切换到下一个API凭证 (非线程安全，需要被外部调用者加锁)
+func (m *APIManager) rotate() {
+	m.current++
+	m.usageCount = 0 // 重置计数器
+}
+
+// RemainingCredentials 返回尚有剩余额度的凭证数量 (包括当前凭证)
+func (m *APIManager) RemainingCredentials() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	remaining := len(m.credentials) - m.current
+	if remaining > 0 && m.usageCount >= m.credentials[m.current].Limit() {
+		remaining-- // 当前凭证已达到使用上限
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// CurrentCredential 返回当前凭证在轮换中的序号 (从 0 开始，凭证全部耗尽时等于凭证数量) 及其已使用的次数
+func (m *APIManager) CurrentCredential() (index, usage int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.current, m.usageCount
+}
+
+// MarkUsed 记录 cred 已经实际发送过查询并被 Smarty 接受 (没有因认证失败被标记失效)
+func (m *APIManager) MarkUsed(cred ApiCredential) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.used[cred.AuthID] = true
+}
+
+// UsedCredentials 返回通过 MarkUsed 记录的、实际发送过查询的不同凭证的数量。
+// 只预留过额度、被跳过或因认证失败被标记失效的凭证不计入。
+func (m *APIManager) UsedCredentials() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.used)
+}
+
+// GetAllCredentials 安全地返回当前管理器中所有凭证的副本，包括未通过验证的凭证。
+func (m *APIManager) GetAllCredentials() []ApiCredential {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// 返回一个副本以防止外部修改
+	credsCopy := make([]ApiCredential, 0, len(m.credentials)+len(m.rejected))
+	credsCopy = append(credsCopy, m.credentials...)
+	return append(credsCopy, m.rejected...)
+}
+
+// --- 文件和用户输入辅助函数  ---
+
+// LoadFromFile 从 JSON 配置文件读取凭证，文件不存在时返回空列表
+func LoadFromFile(filename string) ([]ApiCredential, error) {
+	var credentials []ApiCredential
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return credentials, nil
+		}
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	if len(data) == 0 {
+		return credentials, nil
+	}
+	err = json.Unmarshal(data, &credentials)
+	if err != nil {
+		return nil, fmt.Errorf("解析JSON配置文件失败: %w", err)
+	}
+	return cleanCredentials(credentials), nil
+}
+
+// cleanCredentials 去掉凭证首尾的空白以及其中的不可见字符 (如复制粘贴带入的零宽空格)，
+// 这些字符会导致 Smarty 认证失败却很难察觉。清理过的值会记录警告。
+func cleanCredentials(credentials []ApiCredential) []ApiCredential {
+	for i := range credentials {
+		cred := &credentials[i]
+		if cleaned := cleanCredentialValue(cred.AuthID); cleaned != cred.AuthID {
+			log.Printf("警告: 第 %d 组凭证的 Auth ID 含有空白或不可见字符，已自动清理为 %s", i+1, cleaned)
+			cred.AuthID = cleaned
+		}
+		if cleaned := cleanCredentialValue(cred.AuthToken); cleaned != cred.AuthToken {
+			log.Printf("警告: 第 %d 组凭证 (%s) 的 Auth Token 含有空白或不可见字符，已自动清理", i+1, cred.AuthID)
+			cred.AuthToken = cleaned
+		}
+	}
+	return credentials
+}
+
+// cleanCredentialValue 去掉首尾空白，并删除所有不可打印的字符
+func cleanCredentialValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
+
+// SaveToFile 将凭证以 JSON 格式写回配置文件
+func SaveToFile(filename string, credentials []ApiCredential) error {
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return fmt.Errorf("格式化凭证为JSON失败: %w", err)
+	}
+	err = os.WriteFile(filename, data, 0644)
+	if err != nil {
+		return fmt.Errorf("写入配置文件失败: %w", err)
+	}
+	return nil
+}
+
+func getAdditionalCredentialsFromUser(requiredCount int) []ApiCredential {
+	var credentials []ApiCredential
+	scanner := bufio.NewScanner(os.Stdin)
+
+	fmt.Printf("\n--- 需要补充API凭证 ---\n")
+	if requiredCount > 0 {
+		fmt.Printf("您至少需要提供 %d 组新的API凭证才能继续。\n", requiredCount)
+	}
+	fmt.Println("请按提示逐个输入 Auth ID 和 Auth Token (输入空行则停止)。")
+
+	for i := 0; ; i++ {
+		fmt.Printf("\n请输入第 %d 组新凭证:\n", i+1)
+		fmt.Print("  Auth ID: ")
+		scanner.Scan()
+		authID := strings.TrimSpace(scanner.Text())
+		if authID == "" {
+			log.Println("输入为空，已终止凭证添加。")
+			break
+		}
+
+		fmt.Print("  Auth Token: ")
+		scanner.Scan()
+		authToken := strings.TrimSpace(scanner.Text())
+		if authToken == "" {
+			log.Println("输入为空，已终止凭证添加。")
+			break
+		}
+		credentials = append(credentials, ApiCredential{AuthID: authID, AuthToken: authToken})
+		if len(credentials) >= requiredCount {
+			fmt.Println("已满足最低数量要求，您可以选择继续添加或直接按回车停止。")
+		}
+	}
+	fmt.Println("--------------------")
+	return credentials
+}
@@ -0,0 +1,42 @@
+package credential
+
+import "testing"
+
+func TestGetCredentialsLimitSmallerThanBatch(t *testing.T) {
+	m := NewAPIManager([]ApiCredential{
+		{AuthID: "free", MaxUsage: 50},
+		{AuthID: "paid", MaxUsage: 250},
+	})
+	t.Setenv(ExtraCredentialsEnv, "")
+
+	// 100 个地址、每个地址 2 次查询：第一个凭证只能容纳 25 个地址
+	for _, want := range []struct {
+		authID  string
+		granted int
+	}{
+		{"free", 25},
+		{"paid", 100},
+		{"paid", 25},
+	} {
+		cred, granted, ok := m.GetCredentials(100, 2)
+		if !ok || cred.AuthID != want.authID || granted != want.granted {
+			t.Fatalf("GetCredentials(100, 2) = %s, %d, %v; want %s, %d, true", cred.AuthID, granted, ok, want.authID, want.granted)
+		}
+		if _, usage := m.CurrentCredential(); usage > cred.Limit() {
+			t.Fatalf("凭证 %s 的使用次数 %d 超过了上限 %d", cred.AuthID, usage, cred.Limit())
+		}
+	}
+	if _, _, ok := m.GetCredentials(100, 2); ok {
+		t.Error("所有凭证的额度都已用完，GetCredentials() 应返回 false")
+	}
+}
+
+func TestGetCredentialsSkipsCredentialTooSmallForOneAddress(t *testing.T) {
+	m := NewAPIManager([]ApiCredential{{AuthID: "tiny", MaxUsage: 1}, {AuthID: "next"}})
+	t.Setenv(ExtraCredentialsEnv, "")
+
+	cred, granted, ok := m.GetCredentials(10, 3)
+	if !ok || cred.AuthID != "next" || granted != 10 {
+		t.Errorf("GetCredentials(10, 3) = %s, %d, %v; want next, 10, true", cred.AuthID, granted, ok)
+	}
+}
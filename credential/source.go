@@ -0,0 +1,145 @@
+package credential
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Source 是凭证的来源
+type Source interface {
+	Load() ([]ApiCredential, error)
+	// String 返回用于日志的来源描述
+	String() string
+}
+
+// Saver 是可以写回凭证的来源
+type Saver interface {
+	Save(credentials []ApiCredential) error
+}
+
+// FileSource 从本地 JSON 配置文件读取凭证
+type FileSource struct {
+	Path string
+}
+
+// Load 实现 Source 接口
+func (s FileSource) Load() ([]ApiCredential, error) { return LoadFromFile(s.Path) }
+
+// Save 实现 Saver 接口
+func (s FileSource) Save(credentials []ApiCredential) error { return SaveToFile(s.Path, credentials) }
+
+func (s FileSource) String() string { return s.Path }
+
+// VaultSource 从 HashiCorp Vault 的 KV v2 引擎读取凭证。
+// 密钥中的 credentials 字段保存凭证列表，可以是 JSON 数组，也可以是 JSON 字符串。
+type VaultSource struct {
+	// Addr 是 Vault 服务地址，如 https://vault.example.com:8200
+	Addr string
+	// Token 是访问 Vault 的令牌
+	Token string
+	// Path 是 KV v2 的 API 路径，如 secret/data/atmb
+	Path string
+	// Client 为空时使用带 30 秒超时的默认客户端
+	Client *http.Client
+}
+
+// NewVaultSourceFromEnv 使用标准的 VAULT_ADDR 和 VAULT_TOKEN 环境变量创建 VaultSource
+func NewVaultSourceFromEnv(path string) (VaultSource, error) {
+	s := VaultSource{Addr: os.Getenv("VAULT_ADDR"), Token: os.Getenv("VAULT_TOKEN"), Path: path}
+	if s.Addr == "" || s.Token == "" {
+		return s, fmt.Errorf("使用 Vault 需要设置 VAULT_ADDR 和 VAULT_TOKEN 环境变量")
+	}
+	if s.Path == "" {
+		return s, fmt.Errorf("使用 Vault 需要指定密钥路径")
+	}
+	return s, nil
+}
+
+func (s VaultSource) String() string { return "vault:" + s.Path }
+
+func (s VaultSource) url() string {
+	return strings.TrimRight(s.Addr, "/") + "/v1/" + strings.TrimLeft(s.Path, "/")
+}
+
+func (s VaultSource) do(method string, body io.Reader) ([]byte, error) {
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	req, err := http.NewRequest(method, s.url(), body)
+	if err != nil {
+		return nil, fmt.Errorf("创建 Vault 请求失败: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", s.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 Vault 失败: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取 Vault 响应失败: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return nil, fmt.Errorf("vault 返回错误状态 %s", res.Status)
+	}
+	return data, nil
+}
+
+// Load 实现 Source 接口
+func (s VaultSource) Load() ([]ApiCredential, error) {
+	data, err := s.do(http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret struct {
+		Data struct {
+			Data struct {
+				Credentials json.RawMessage `json:"credentials"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("解析 Vault 响应失败: %w", err)
+	}
+
+	raw := secret.Data.Data.Credentials
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("vault 密钥 %s 中没有 credentials 字段", s.Path)
+	}
+	// credentials 以字符串形式保存时先取出其中的 JSON
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		raw = json.RawMessage(encoded)
+	}
+
+	var credentials []ApiCredential
+	if err := json.Unmarshal(raw, &credentials); err != nil {
+		return nil, fmt.Errorf("解析 Vault 中的凭证失败: %w", err)
+	}
+	return cleanCredentials(credentials), nil
+}
+
+// Save 实现 Saver 接口，将凭证作为新版本写回 Vault
+func (s VaultSource) Save(credentials []ApiCredential) error {
+	payload, err := json.Marshal(map[string]any{
+		"data": map[string]any{"credentials": credentials},
+	})
+	if err != nil {
+		return fmt.Errorf("格式化凭证为JSON失败: %w", err)
+	}
+	_, err = s.do(http.MethodPost, bytes.NewReader(payload))
+	return err
+}
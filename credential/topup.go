@@ -0,0 +1,77 @@
+package credential
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ExtraCredentialsEnv 是保存补充凭证的环境变量，内容与配置文件相同，是凭证的 JSON 数组
+const ExtraCredentialsEnv = "ATMB_EXTRA_CREDS"
+
+// ExtraCredentialsFile 是保存补充凭证的 JSON 文件 (格式与配置文件相同)，为空表示不使用。
+// 每次凭证耗尽时都会重新读取，运行中向该文件追加的凭证也能被使用。
+var ExtraCredentialsFile string
+
+// additionalCredentials 在所有凭证耗尽时补充新的凭证 (非线程安全，需要被外部调用者加锁)：
+// 先从 ExtraCredentialsEnv 和 ExtraCredentialsFile 中取出尚未使用过的凭证；
+// 都没有时，标准输入是终端则提示用户输入，否则 (如 CI 等无人值守的环境) 立即返回空列表，
+// 而不是在已关闭的标准输入上一直等待。
+func (m *APIManager) additionalCredentials(requiredCount int) []ApiCredential {
+	if extra := m.unusedCredentials(loadExtraCredentials()); len(extra) > 0 {
+		return extra
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		log.Printf("标准输入不是终端，无法交互输入凭证；%s 和补充凭证文件中也没有未使用过的凭证。", ExtraCredentialsEnv)
+		return nil
+	}
+	return getAdditionalCredentialsFromUser(requiredCount)
+}
+
+// loadExtraCredentials 读取环境变量和补充凭证文件中的凭证，读取失败时记录警告并忽略该来源
+func loadExtraCredentials() []ApiCredential {
+	var credentials []ApiCredential
+	if value := os.Getenv(ExtraCredentialsEnv); value != "" {
+		var fromEnv []ApiCredential
+		if err := json.Unmarshal([]byte(value), &fromEnv); err != nil {
+			log.Printf("警告: 解析环境变量 %s 失败: %v", ExtraCredentialsEnv, err)
+		} else {
+			credentials = append(credentials, cleanCredentials(fromEnv)...)
+		}
+	}
+	if ExtraCredentialsFile != "" {
+		fromFile, err := LoadFromFile(ExtraCredentialsFile)
+		if err != nil {
+			log.Printf("警告: 读取补充凭证文件 %s 失败: %v", ExtraCredentialsFile, err)
+		} else {
+			credentials = append(credentials, fromFile...)
+		}
+	}
+	return credentials
+}
+
+// unusedCredentials 去掉已经在管理器中 (包括已耗尽和未通过验证的) 以及不完整的凭证，
+// 避免同一组凭证在每次耗尽后被反复加入 (非线程安全，需要被外部调用者加锁)
+func (m *APIManager) unusedCredentials(candidates []ApiCredential) []ApiCredential {
+	known := make(map[string]bool, len(m.credentials)+len(m.rejected))
+	for _, cred := range m.credentials {
+		known[cred.AuthID] = true
+	}
+	for _, cred := range m.rejected {
+		known[cred.AuthID] = true
+	}
+	var unused []ApiCredential
+	for _, cred := range candidates {
+		if cred.AuthID == "" || cred.AuthToken == "" || known[cred.AuthID] {
+			continue
+		}
+		known[cred.AuthID] = true
+		unused = append(unused, cred)
+	}
+	if len(unused) > 0 {
+		log.Printf("从 %s 或补充凭证文件中取得 %d 组新凭证。", ExtraCredentialsEnv, len(unused))
+	}
+	return unused
+}
@@ -0,0 +1,49 @@
+package credential
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+// ErrInvalidCredential 表示凭证未通过 Smarty 认证 (AuthID 或 AuthToken 错误、账号欠费或无权限)
+var ErrInvalidCredential = errors.New("invalid credential")
+
+// CheckFunc 使用凭证发送一次测试查询。凭证认证失败时返回包装了 ErrInvalidCredential 的错误；
+// 网络故障等其他错误无法说明凭证是否有效。
+type CheckFunc func(ctx context.Context, cred ApiCredential) error
+
+// ValidateCredentials 对每组尚未使用的凭证调用 check，认证失败的凭证被移出轮换，返回剩余的凭证数量。
+// 被移出的凭证仍然保留在 GetAllCredentials 的结果中，以免写回凭证文件时丢失，方便修正后再次使用。
+// 因网络等原因无法确认的凭证视为有效，留给运行中的重试策略处理。
+func (m *APIManager) ValidateCredentials(ctx context.Context, check CheckFunc) int {
+	m.mutex.Lock()
+	pending := append([]ApiCredential(nil), m.credentials[m.current:]...)
+	m.mutex.Unlock()
+
+	var valid, rejected []ApiCredential
+	unconfirmed := 0
+	for i, cred := range pending {
+		err := check(ctx, cred)
+		switch {
+		case err == nil:
+			log.Printf("凭证 %d/%d (%s) 验证通过。", i+1, len(pending), cred.AuthID)
+			valid = append(valid, cred)
+		case errors.Is(err, ErrInvalidCredential):
+			log.Printf("凭证 %d/%d (%s) 认证失败，已移出轮换: %v", i+1, len(pending), cred.AuthID, err)
+			rejected = append(rejected, cred)
+		default:
+			log.Printf("警告: 无法确认凭证 %d/%d (%s) 是否有效，仍将使用: %v", i+1, len(pending), cred.AuthID, err)
+			valid = append(valid, cred)
+			unconfirmed++
+		}
+	}
+	log.Printf("凭证验证完毕: 共 %d 组，有效 %d 组 (其中 %d 组无法确认)，认证失败 %d 组。",
+		len(pending), len(valid), unconfirmed, len(rejected))
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.credentials = append(m.credentials[:m.current], valid...)
+	m.rejected = append(m.rejected, rejected...)
+	return len(valid)
+}
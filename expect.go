@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+)
+
+// stateCounts 记录每个州实际抓取到的地址数量，键为州 slug 和显示名称经 stateOrderKey 规范化后的键
+type stateCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// newStateCounts 按 pipeline.Results.StateCounts (州 slug -> 数量) 创建 stateCounts
+func newStateCounts(counts map[string]int) *stateCounts {
+	c := &stateCounts{counts: make(map[string]int, len(counts))}
+	for state, n := range counts {
+		c.Record(state, n)
+	}
+	return c
+}
+
+// Record 记录某个州抓取到的地址数量
+func (c *stateCounts) Record(state string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range stateKeys(state) {
+		c.counts[key] = n
+	}
+}
+
+// get 返回某个州抓取到的地址数量，以及该州是否被抓取过；state 可以是州名或 slug
+func (c *stateCounts) get(state string) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, ok := c.counts[stateOrderKey(state)]
+	return n, ok
+}
+
+// checkExpectations 将各州实际抓取到的数量 scraped 与 expected (规范化后的州名或 slug -> 预期数量) 对比，
+// 偏差超过 tolerance 百分比的州会被记录警告，返回偏差过大的州的数量。
+// 没有被抓取的州 (如被 -skip-states 跳过) 不参与对比。
+func checkExpectations(scraped *stateCounts, expected map[string]int, tolerance float64) int {
+	states := make([]string, 0, len(expected))
+	for state := range expected {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	deviations := 0
+	for _, state := range states {
+		want := expected[state]
+		got, ok := scraped.get(state)
+		if !ok {
+			log.Printf("预期检查: %s 本次没有抓取，跳过。", state)
+			continue
+		}
+		diff := math.Abs(float64(got - want))
+		percent := 0.0
+		if want > 0 {
+			percent = diff / float64(want) * 100
+		} else if got > 0 {
+			percent = math.Inf(1)
+		}
+		if percent > tolerance {
+			log.Printf("!!预期检查!! %s 抓取到 %d 个地址，预期 %d 个，偏差 %.1f%% 超过允许的 %.1f%%。", state, got, want, percent, tolerance)
+			deviations++
+		}
+	}
+	if deviations == 0 {
+		log.Printf("预期检查: %d 个州的地址数量均在允许的 %.1f%% 偏差范围内。", len(expected), tolerance)
+	}
+	return deviations
+}
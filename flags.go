@@ -0,0 +1,473 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"atmb/credential"
+	"atmb/output"
+	"atmb/pipeline"
+	"atmb/scrape"
+	"atmb/verify"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+)
+
+// 州列表的获取方式
+const (
+	discoveryLive   = "live"
+	discoveryStatic = "static"
+)
+
+// 凭证来源
+const (
+	sourceFile  = "file"
+	sourceVault = "vault"
+)
+
+var (
+	// credentialSource 是凭证来源，通过 -credential-source 参数配置
+	credentialSource string
+	// vaultPath 是 Vault KV v2 中保存凭证的 API 路径
+	vaultPath string
+	// credentialWriteBack 为 true 时，运行结束后把凭证写回密钥管理服务
+	credentialWriteBack bool
+	// stateDiscovery 是州列表的获取方式，通过 -discovery 参数配置
+	stateDiscovery string
+	// outputFormats 是结果文件的格式，通过 -format 参数配置，可以同时指定多个 (如 csv,parquet)
+	outputFormats []string
+	// outputShards 是结果写入的分片数量，通过 -output-shards 参数配置
+	outputShards int
+	// smartyRecordDir 不为空时，每次 Smarty 响应都会被保存到该目录
+	smartyRecordDir string
+	// smartyReplayDir 不为空时，从该目录读取已保存的响应，不再调用 Smarty API
+	smartyReplayDir string
+	// maxLookups 是本次运行 Smarty 查询总次数的上限，0 表示不限制
+	maxLookups int64
+	// autocompleteFallback 为 true 时，对无法验证的地址查询 Autocomplete 建议
+	autocompleteFallback bool
+	// inputFile 不为空时，从该 CSV 文件读取待验证的地址，不再抓取 ATMB
+	inputFile string
+	// inputMapping 是地址字段到输入 CSV 列名的映射
+	inputMapping map[string]string
+	// statusAddr 不为空时，在该地址上启动状态服务 (/healthz, /readyz)
+	statusAddr string
+	// dedupeFile 不为空时，只对该结果文件去重后退出
+	dedupeFile string
+	// threshold 是每个州的最低地址数量，低于该数量时发出警告
+	threshold = &stateThreshold{}
+	// maxRetries 是 Smarty 验证失败后的最大重试次数 (默认总共会尝试 1 + 4 = 5次)，
+	// 第 n 次重试前等待 initialBackoff * 2^(n-1)，不超过 maxBackoff
+	maxRetries     = pipeline.DefaultMaxRetries
+	initialBackoff = pipeline.DefaultInitialBackoff
+	maxBackoff     = pipeline.DefaultMaxBackoff
+	// abbreviateStreet 为 true 时验证前把街道中的常见单词换成 USPS 标准缩写
+	abbreviateStreet bool
+	// workerRamp 是工作单元错开启动的总时长，0 表示同时启动
+	workerRamp time.Duration
+	// selfTest 为 true 时，只对 selfTestState 运行抓取自检后退出
+	selfTest      bool
+	selfTestState string
+	// selfTestHTML 不为空时，自检解析该文件中保存的州页面而不是实时抓取
+	selfTestHTML string
+	// streamFailed 为 true 时，失败任务在产生时立即写入文件
+	streamFailed bool
+	// slowThreshold 大于 0 时，耗时超过该值的 Smarty 请求会被单独记录
+	slowThreshold time.Duration
+	// parallelismReport 大于 0 时，按该间隔记录抓取和验证阶段的吞吐量，并在结束时输出报告
+	parallelismReport time.Duration
+	// progressInterval 大于 0 时，按该间隔输出已发现、已处理和失败的地址数量
+	progressInterval time.Duration
+	// diffBaseline 不为空时，运行结束后将 results.csv 与该基线文件对比并输出变化报告
+	diffBaseline string
+	// drainOnShutdown 为 true 时，关闭后继续处理 jobs 中已排队的地址，最多等待 shutdownGrace；
+	// 为 false 时立即取消请求，已排队的地址直接记为失败
+	drainOnShutdown bool
+	shutdownGrace   time.Duration
+	// matchChain 是验证地址时依次尝试的匹配策略，为空时只使用 strict
+	matchChain []street.MatchStrategy
+	// splitByState 为 true 时，CSV 结果按州写入与 -output 同名的目录下的 <state>.csv
+	splitByState bool
+	// maxCandidates 是每个地址最多返回的候选数量，大于 1 时输出 Candidates 和 LowConfidence 列
+	maxCandidates int
+	// maxMemoryRows 大于 0 时，CSV 写入器在内存中最多缓冲该数量的结果，超出部分溢出到临时文件
+	maxMemoryRows int
+	// expectedCounts 是 -expect 文件中按州 (小写) 指定的预期地址数量，
+	// 运行结束后与实际数量对比，偏差超过 expectTolerance 百分比时报告
+	expectedCounts  map[string]int
+	expectTolerance float64
+	expectStrict    bool
+	// verifyOnlyChanged 为 true 时只验证卡片内容自上次运行以来发生变化的地点，
+	// 内容哈希和验证结果保存在 hashCacheFile 中
+	verifyOnlyChanged bool
+	hashCacheFile     string
+	// availableOnly 为 true 时跳过尚未开业的地点
+	availableOnly bool
+	// stateOrder 决定州分发给抓取工作单元的顺序，为 nil 时保持获取州列表时的顺序
+	stateOrder stateOrderFunc
+	// samplePerState 大于 0 时每个州最多推送这么多个地址去验证，用于低成本地试跑整个流程
+	samplePerState int
+	// onlyNonCMRA 为 true 时只写入非 CMRA 地址，CMRA 状态未知的地址按 unknownCMRA 处理
+	onlyNonCMRA bool
+	unknownCMRA string
+	// skipValidation 为 true 时启动时不验证凭证
+	skipValidation bool
+	// dryRun 为 true 时照常抓取，但不调用 Smarty，地址的 CMRA/RDI 保持 UNKNOWN
+	dryRun bool
+	// runTimeout 大于 0 时是整个运行的期限，到期后停止所有请求和工作单元
+	runTimeout time.Duration
+	// checkpointFile 不为空时，验证成功的地址会记录到该文件，重新运行时跳过
+	checkpointFile string
+	// configFile 是本地凭证文件的路径
+	configFile string
+	// credsDir 不为空时，从该目录的每个 *.json 文件中读取凭证，与凭证来源中的凭证合并
+	credsDir string
+	// resultsFile 是 CSV 结果文件的路径，GeoJSON、Parquet 结果使用相同的文件名和各自的扩展名
+	resultsFile string
+	// stateList 是通过 -states 参数或 -states-file 文件指定的州 slug，不为空时不再获取州列表
+	stateList []string
+	// skipStateList 是需要跳过的州，通过 -skip-states 参数配置
+	skipStateList []string
+)
+
+// parseFlags 解析命令行参数并校验取值，非法参数直接终止程序
+func parseFlags() {
+	flag.Int64Var(&scrape.MaxBodySize, "max-body-size", scrape.DefaultMaxBodySize, "抓取页面时允许的最大响应体大小 (字节)")
+	flag.StringVar(&smartyRecordDir, "record-smarty", "", "将每次 Smarty 响应按地址保存到该目录")
+	flag.StringVar(&smartyReplayDir, "replay-smarty", "", "从该目录回放已保存的 Smarty 响应，不调用 API")
+	format := flag.String("format", "csv", "结果文件格式: csv, geojson, parquet, sqlite, jsonl 或 xlsx，逗号分隔可同时写入多种格式，如 csv,parquet")
+	flag.IntVar(&outputShards, "output-shards", 1, "结果写入的分片数量，大于 1 时并行写入分片文件并在最后合并")
+	flag.BoolVar(&scrape.ParseTitles, "parse-title", false, "将卡片标题解析为地点名称和描述，并输出 LocationName、Descriptor 列")
+	flag.Int64Var(&maxLookups, "max-lookups", 0, "本次运行 Smarty 查询总次数的上限，达到后停止验证并将剩余地址记为失败 (0 表示不限制)")
+	flag.Int64Var(&maxLookups, "max-total-lookups", 0, "-max-lookups 的别名")
+	flag.BoolVar(&autocompleteFallback, "autocomplete-fallback", false, "地址无法验证时查询 Smarty Autocomplete 建议，写入失败任务文件的 Suggestion 列")
+	flag.StringVar(&inputFile, "input", "", "从 CSV 文件读取待验证的地址，不再抓取 ATMB")
+	mapping := flag.String("input-mapping", "", "输入 CSV 的字段映射，如 street=Address1,city=City,state=ST,zip=PostalCode (默认按同名列匹配)")
+	flag.StringVar(&statusAddr, "status-addr", "", "状态服务监听地址，如 :8080，提供 /healthz、/readyz、/status 和 /metrics")
+	flag.StringVar(&dedupeFile, "dedupe", "", "对指定的结果 CSV 去重 (按 LocationID 或 Link) 并原地重写，然后退出")
+	flag.IntVar(&threshold.min, "min-per-state", 0, "每个州至少应抓取到的地址数量，低于该数量时发出警告 (0 表示不检查)")
+	baseline := flag.String("min-per-state-file", "", "按州指定最低地址数量的 JSON 文件，如 {\"California\": 50}，优先于 -min-per-state")
+	flag.IntVar(&threshold.requeue, "requeue-short-states", 0, "州的地址数量低于最低数量时重新抓取的次数")
+	flag.StringVar(&output.SortOrder, "sort", output.SortNone, "结果排序方式: price (按月租价格升序，价格未知的排在最后)")
+	flag.DurationVar(&workerRamp, "worker-ramp", 0, "工作单元错开启动的总时长，如 10s，每个工作单元间隔 ramp/工作单元数 启动 (0 表示同时启动)")
+	flag.BoolVar(&selfTest, "selftest", false, "抓取一个已知州的页面检查解析是否正常，失败时以非零状态退出")
+	flag.StringVar(&selfTestState, "selftest-state", "california", "自检时抓取的州 (slug 或州名，如 new-york 或 \"New York\")")
+	flag.StringVar(&selfTestHTML, "selftest-html", "", "用保存的州页面 HTML 文件运行自检 (不访问网络)，输出解析出的每个地址")
+	flag.BoolVar(&streamFailed, "stream-failed", true, "失败任务产生时立即写入 failed_results.csv，程序被中断也不会丢失 (-stream-failed=false 时在结束时统一写入)")
+	flag.StringVar(&stateDiscovery, "discovery", discoveryLive, "州列表获取方式: live (从网站抓取，失败时使用内置列表) 或 static (只使用内置列表)")
+	flag.DurationVar(&slowThreshold, "slow-threshold", 0, "耗时超过该值的 Smarty 请求会被单独记录日志，如 2s (0 表示不记录)")
+	flag.StringVar(&credentialSource, "credential-source", sourceFile, "凭证来源: file (config.json) 或 vault (HashiCorp Vault KV v2，需设置 VAULT_ADDR 和 VAULT_TOKEN)")
+	flag.StringVar(&vaultPath, "vault-path", "secret/data/atmb", "Vault 中保存凭证的 KV v2 API 路径")
+	flag.BoolVar(&credentialWriteBack, "credential-write-back", false, "运行结束后把新增的凭证写回密钥管理服务 (file 来源总是写回)")
+	flag.DurationVar(&parallelismReport, "parallelism-report", 0, "按该间隔记录抓取和验证阶段的吞吐量，并在结束时输出各阶段的吞吐量和空闲时间，如 30s (0 表示关闭)")
+	flag.StringVar(&scrape.UserAgent, "user-agent", envOr("ATMB_USER_AGENT", scrape.DefaultUserAgent), "抓取 ATMB 页面时使用的 User-Agent (也可以通过 ATMB_USER_AGENT 环境变量设置)")
+	flag.Float64Var(&scrape.RequestsPerSecond, "atmb-rps", scrape.DefaultRequestsPerSecond, "所有抓取工作单元合计每秒最多发出的请求数 (0 表示不限制)")
+	flag.IntVar(&scrape.MaxPages, "max-pages", scrape.MaxPages, "单个州最多抓取的页面数，防止分页链接循环")
+	flag.StringVar(&scrape.PaginationFailureMode, "pagination-failure-mode", scrape.PageSkip, "州页面分页中途某一页抓取失败时的处理方式: skip-page (跳过该页), fail-state (重新抓取整个州) 或 retry-page (重试该页)")
+	flag.StringVar(&diffBaseline, "diff", "", "运行结束后将 results.csv 与指定的基线结果对比 (按 LocationID 或 Link)，把新增、下架和价格/CMRA 变化写入 diff_report.json")
+	flag.BoolVar(&drainOnShutdown, "drain-on-shutdown", false, "关闭时继续处理队列中已排队的地址 (最多等待 -shutdown-grace)，否则立即把它们记为失败")
+	flag.DurationVar(&shutdownGrace, "shutdown-grace", 30*time.Second, "-drain-on-shutdown 开启时处理剩余队列的最长时间，超时后取消剩余请求")
+	chain := flag.String("match-chain", "", "验证地址时依次尝试的匹配策略，如 strict,enhanced，并输出 MatchTier 列 (默认只使用 strict)")
+	flag.IntVar(&maxMemoryRows, "max-memory-rows", 0, "CSV 写入时内存中最多缓冲的结果数，超出部分溢出到临时文件并在结束时归并 (0 表示不限制)")
+	flag.BoolVar(&scrape.SkipLinklessCards, "skip-linkless-cards", false, "跳过没有链接的地址卡片 (默认保留，Link 列为空并记录警告)")
+	autoWorkers := flag.Bool("auto-workers", false, "按 CPU 数量自动设置抓取和验证工作单元的数量")
+	expectFile := flag.String("expect", "", "按州指定预期地址数量的 JSON 文件，如 {\"California\": 50}，运行结束后报告偏差过大的州")
+	flag.Float64Var(&expectTolerance, "expect-tolerance", 10, "-expect 允许的偏差百分比")
+	flag.BoolVar(&expectStrict, "expect-strict", false, "-expect 检查发现偏差过大的州时以非零状态退出")
+	flag.DurationVar(&smartyTimeout, "smarty-timeout", 10*time.Second, "单次 Smarty 请求的超时时间")
+	flag.DurationVar(&smartyBatchTimeout, "smarty-batch-timeout", 20*time.Second, "每次 Smarty 批量请求的总期限 (包括 SDK 内部的重试)，到期后按超时错误重试或放弃该批次的地址 (0 表示不限制)")
+	flag.IntVar(&smartyMaxRetry, "smarty-max-retry", -1, "Smarty SDK 内部对网络错误的重试次数 (-1 表示使用 SDK 默认值)")
+	flag.IntVar(&smartyBatchSize, "smarty-batch-size", verify.MaxBatchSize, fmt.Sprintf("每次 Smarty 批量请求最多包含的地址数量 (1-%d)", verify.MaxBatchSize))
+	flag.StringVar(&smartyProxy, "smarty-proxy", "", "Smarty 请求使用的代理地址，如 http://proxy.example.com:3128 (默认使用 HTTP_PROXY/HTTPS_PROXY 环境变量)")
+	flag.BoolVar(&verifyOnlyChanged, "verify-only-changed", false, "只验证卡片内容自上次运行以来发生变化的地点，未变化的地点复用上次的 CMRA/RDI")
+	flag.StringVar(&hashCacheFile, "hash-cache", "content_hashes.json", "-verify-only-changed 使用的内容哈希缓存文件")
+	flag.BoolVar(&availableOnly, "available-only", false, "跳过卡片上标记为即将开业 (coming soon) 的地点")
+	statusColumn := flag.Bool("status-column", false, "在结果中额外输出地点的营业状态 (Status 列: available 或 coming soon)")
+	flag.BoolVar(&onlyNonCMRA, "only-non-cmra", false, "只写入非 CMRA 地址，丢弃 CMRA 为 Y 的地址")
+	flag.StringVar(&unknownCMRA, "unknown-cmra", output.UnknownCMRAKeep, "-only-non-cmra 开启时 CMRA 状态未知 (非 Y/N) 的地址的处理方式: keep 或 drop")
+	flag.DurationVar(&runTimeout, "timeout", 0, "整个运行的期限 (如 2h)，到期后中止所有请求，已完成的结果照常写入 (0 表示不限制)")
+	flag.StringVar(&checkpointFile, "checkpoint", "", "记录已验证地址的检查点文件，如 processed.jsonl；程序中途退出后使用相同参数重新运行时跳过这些地址")
+	flag.StringVar(&configFile, "config", "config.json", "Smarty 凭证文件的路径")
+	flag.StringVar(&credsDir, "creds-dir", "", "凭证目录：读取其中每个 *.json 文件 (单个凭证对象或凭证数组)，与 -config 或 Vault 中的凭证合并，按 Auth ID 去重；目录中的凭证不会写回")
+	flag.StringVar(&resultsFile, "output", "results.csv", "结果文件的路径，geojson、parquet、sqlite、jsonl 格式使用相同的文件名和各自的扩展名")
+	scrapyWorkers := flag.Int("scrapy-workers", numScrapyWorkers, "Smarty 验证工作单元的数量 (也可以通过 SCRAPY_WORKERS 环境变量设置)")
+	atmbWorkers := flag.Int("atmb-workers", numATMBWorkers, "ATMB 抓取工作单元的数量 (也可以通过 ATMB_WORKERS 环境变量设置)")
+	flag.BoolVar(&dryRun, "dry-run", false, "试运行: 照常抓取并写入结果，但不调用 Smarty、不需要凭证，CMRA/RDI 保持 UNKNOWN")
+	states := flag.String("states", "", "逗号分隔的州 slug (如 california,new-york)，只抓取这些州，不再获取州列表")
+	statesFile := flag.String("states-file", "", "州列表文件 (如 states.txt)，每行一个州 slug，与 -states 合并使用")
+	columns := flag.String("columns", "", "结果文件输出的列及其顺序，逗号分隔 (如 State,Zip,CMRA,RDI，不区分大小写)，替换默认列和其他参数附加的列；失败任务文件在这些列之后附加 FailReason 和 Suggestion (已选择的除外)")
+	smartyFields := flag.String("smarty-fields", "", "在结果中额外输出的 Smarty 字段，逗号分隔: county, latitude, longitude, vacant, record_type, congressional_district")
+	flag.DurationVar(&progressInterval, "progress-interval", 30*time.Second, "按该间隔输出运行进度 (已抓取的州、已发现、已处理和失败的地址数量)，如 1m (0 表示关闭)")
+	flag.BoolVar(&output.AppendCSV, "append", false, "将结果追加到已有的 CSV 结果文件末尾，而不是覆盖它 (只在新文件或空文件中写入表头)")
+	flag.BoolVar(&skipValidation, "skip-validation", false, "启动时不验证凭证 (默认对每组凭证发送一次测试查询，移除认证失败的凭证)")
+	flag.IntVar(&maxCandidates, "max-candidates", 1, fmt.Sprintf("每个地址最多返回的 Smarty 候选数量 (1-%d)，大于 1 时输出 Candidates 和 LowConfidence 列，用于识别有歧义的匹配", verify.MaxCandidatesLimit))
+	flag.BoolVar(&splitByState, "split-by-state", false, "按州将 CSV 结果写入与 -output 同名的目录，如 results/california.csv，每个州一个文件")
+	flag.IntVar(&maxRetries, "max-retries", maxRetries, "Smarty 验证失败后的最大重试次数 (总共最多尝试 1 + max-retries 次)")
+	flag.DurationVar(&initialBackoff, "initial-backoff", initialBackoff, "第一次重试前的退避时间，之后每次翻倍")
+	flag.DurationVar(&maxBackoff, "max-backoff", maxBackoff, "单次重试退避时间的上限，实际等待时间在此基础上随机浮动 ±20%")
+	atmbProxy := flag.String("atmb-proxy", os.Getenv("ATMB_PROXY"), "抓取 ATMB 使用的代理，逗号分隔多个代理时每个请求轮流使用下一个，如 http://user:pass@p1:3128,http://p2:3128 (也可以通过 ATMB_PROXY 环境变量设置)")
+	flag.BoolVar(&smartyViaATMBProxy, "smarty-via-atmb-proxy", false, "Smarty 请求也轮流使用 -atmb-proxy 中的代理")
+	delimiter := flag.String("delimiter", ",", "CSV 结果和失败任务文件的字段分隔符：单个字符，或 comma、tab (也可以写成 \\t)、semicolon、pipe")
+	flag.StringVar(&credential.ExtraCredentialsFile, "extra-credentials", "", "凭证耗尽时从该 JSON 文件 (格式与 config.json 相同) 补充尚未使用过的凭证，每次耗尽时重新读取")
+	flag.IntVar(&samplePerState, "sample-per-state", 0, "每个州最多验证的地址数量，按页面顺序取前 N 个，用于低成本地试跑整个流程 (0 表示不限制)")
+	order := flag.String("state-order", orderDiscovery, "州的处理顺序: alpha (按字母)、expected (按 -expect 或 -min-per-state-file 中的预期地址数量从多到少) 或 priority (-state-priority 中的州优先)；默认保持获取州列表时的顺序")
+	priority := flag.String("state-priority", "", "逗号分隔的州 (名称或 slug)，-state-order priority 时按给定顺序优先处理，如 california,texas,florida")
+	flag.BoolVar(&abbreviateStreet, "abbreviate-street", false, "验证前将街道中的常见单词换成 USPS 标准缩写，如 Street -> St、Suite -> Ste")
+	skip := flag.String("skip-states", "", "逗号分隔的州列表，抓取时跳过这些州")
+	logFormat := flag.String("log-format", "text", "日志格式: text (默认，便于阅读) 或 json (结构化日志，便于日志收集系统解析)")
+	flag.Parse()
+	if err := pipeline.ConfigureLogging(*logFormat); err != nil {
+		log.Fatalf("-log-format 参数错误: %v", err)
+	}
+	var err error
+	skipStateList = splitList(*skip)
+	if stateList, err = loadStateList(*states, *statesFile); err != nil {
+		log.Fatalf("-states/-states-file 参数错误: %v", err)
+	}
+	if selfTestState, err = scrape.ParseStateSlug(selfTestState); err != nil {
+		log.Fatalf("-selftest-state 参数错误: %v", err)
+	}
+	if *autoWorkers {
+		configureWorkers(runtime.NumCPU())
+	}
+	// 工作单元数量的优先级: 命令行参数 > 环境变量 > -auto-workers > 默认值
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	if numScrapyWorkers, err = workerCount("scrapy-workers", "SCRAPY_WORKERS", *scrapyWorkers, numScrapyWorkers, explicit); err != nil {
+		log.Fatal(err)
+	}
+	if numATMBWorkers, err = workerCount("atmb-workers", "ATMB_WORKERS", *atmbWorkers, numATMBWorkers, explicit); err != nil {
+		log.Fatal(err)
+	}
+	if *baseline != "" {
+		if threshold.perState, err = loadStateBaseline(*baseline); err != nil {
+			log.Fatalf("-min-per-state-file 参数错误: %v", err)
+		}
+	}
+	if *expectFile != "" {
+		if expectedCounts, err = loadStateBaseline(*expectFile); err != nil {
+			log.Fatalf("-expect 参数错误: %v", err)
+		}
+	}
+	if stateOrder, err = newStateOrder(*order, splitList(*priority)); err != nil {
+		log.Fatalf("-state-order 参数错误: %v", err)
+	}
+	if expectTolerance < 0 {
+		log.Fatalf("-expect-tolerance 不能为负数，当前值: %v", expectTolerance)
+	}
+	if threshold.min < 0 || threshold.requeue < 0 {
+		log.Fatalf("-min-per-state 和 -requeue-short-states 不能为负数")
+	}
+	if inputMapping, err = parseInputMapping(*mapping); err != nil {
+		log.Fatalf("-input-mapping 参数错误: %v", err)
+	}
+	if *chain != "" {
+		if matchChain, err = verify.ParseMatchChain(*chain); err != nil {
+			log.Fatalf("-match-chain 参数错误: %v", err)
+		}
+		output.Columns = append(output.Columns, output.MatchTierColumns...)
+	}
+	if scrape.ParseTitles {
+		output.Columns = append(output.Columns, output.TitleColumns...)
+	}
+	if maxCandidates < 1 || maxCandidates > verify.MaxCandidatesLimit {
+		log.Fatalf("-max-candidates 必须在 1 到 %d 之间，当前值: %d", verify.MaxCandidatesLimit, maxCandidates)
+	}
+	if maxCandidates > 1 {
+		output.Columns = append(output.Columns, output.ConfidenceColumns...)
+	}
+	extraColumns, err := output.ParseSmartyFields(*smartyFields)
+	if err != nil {
+		log.Fatalf("-smarty-fields 参数错误: %v", err)
+	}
+	output.Columns = append(output.Columns, extraColumns...)
+	if *statusColumn {
+		output.Columns = append(output.Columns, output.StatusColumns...)
+	}
+	if *columns != "" {
+		if output.Columns, err = output.ParseColumns(*columns); err != nil {
+			log.Fatalf("-columns 参数错误: %v", err)
+		}
+	}
+	if output.Delimiter, err = output.ParseDelimiter(*delimiter); err != nil {
+		log.Fatalf("-delimiter 参数错误: %v", err)
+	}
+	if scrape.MaxBodySize <= 0 {
+		log.Fatalf("-max-body-size 必须大于 0，当前值: %d", scrape.MaxBodySize)
+	}
+	outputFormats = splitList(*format)
+	if len(outputFormats) == 0 {
+		log.Fatalf("-format 不能为空")
+	}
+	for i, f := range outputFormats {
+		if f != "csv" && f != "geojson" && f != "parquet" && f != "sqlite" && f != "jsonl" && f != "xlsx" {
+			log.Fatalf("不支持的输出格式: %s (可选 csv, geojson, parquet, sqlite, jsonl, xlsx)", f)
+		}
+		if slices.Contains(outputFormats[:i], f) {
+			log.Fatalf("-format 中重复指定了 %s", f)
+		}
+	}
+	if maxLookups < 0 {
+		log.Fatalf("-max-lookups 不能为负数，当前值: %d", maxLookups)
+	}
+	if stateDiscovery != discoveryLive && stateDiscovery != discoveryStatic {
+		log.Fatalf("不支持的州列表获取方式: %s (可选 %s, %s)", stateDiscovery, discoveryLive, discoveryStatic)
+	}
+	if parallelismReport < 0 {
+		log.Fatalf("-parallelism-report 不能为负数，当前值: %v", parallelismReport)
+	}
+	if progressInterval < 0 {
+		log.Fatalf("-progress-interval 不能为负数，当前值: %v", progressInterval)
+	}
+	if maxRetries < 0 {
+		log.Fatalf("-max-retries 不能为负数，当前值: %d", maxRetries)
+	}
+	if initialBackoff <= 0 || maxBackoff < initialBackoff {
+		log.Fatalf("-initial-backoff 必须大于 0 且不大于 -max-backoff，当前值: %v, %v", initialBackoff, maxBackoff)
+	}
+	if runTimeout < 0 {
+		log.Fatalf("-timeout 不能为负数，当前值: %v", runTimeout)
+	}
+	if shutdownGrace < 0 {
+		log.Fatalf("-shutdown-grace 不能为负数，当前值: %v", shutdownGrace)
+	}
+	if smartyTimeout <= 0 {
+		log.Fatalf("-smarty-timeout 必须大于 0，当前值: %v", smartyTimeout)
+	}
+	if smartyBatchTimeout < 0 {
+		log.Fatalf("-smarty-batch-timeout 不能为负数，当前值: %v", smartyBatchTimeout)
+	}
+	if smartyBatchSize < 1 || smartyBatchSize > verify.MaxBatchSize {
+		log.Fatalf("-smarty-batch-size 必须在 1 到 %d 之间，当前值: %d", verify.MaxBatchSize, smartyBatchSize)
+	}
+	if err := scrape.ConfigureProxies(splitList(*atmbProxy)); err != nil {
+		log.Fatalf("-atmb-proxy 参数错误: %v", err)
+	}
+	if err := configureSmartyClient(); err != nil {
+		log.Fatalf("Smarty 代理参数错误: %v", err)
+	}
+	if samplePerState < 0 {
+		log.Fatalf("-sample-per-state 不能为负数，当前值: %d", samplePerState)
+	}
+	if workerRamp < 0 {
+		log.Fatalf("-worker-ramp 不能为负数，当前值: %v", workerRamp)
+	}
+	if outputShards < 1 {
+		log.Fatalf("-output-shards 必须大于等于 1，当前值: %d", outputShards)
+	}
+	if err := output.ValidateSortOrder(output.SortOrder); err != nil {
+		log.Fatalf("-sort 参数错误: %v", err)
+	}
+	if err := output.ValidateUnknownCMRA(unknownCMRA); err != nil {
+		log.Fatalf("-unknown-cmra 参数错误: %v", err)
+	}
+	if scrape.RequestsPerSecond < 0 {
+		log.Fatalf("-atmb-rps 不能为负数，当前值: %v", scrape.RequestsPerSecond)
+	}
+	if scrape.MaxPages < 1 {
+		log.Fatalf("-max-pages 必须大于等于 1，当前值: %d", scrape.MaxPages)
+	}
+	if err := scrape.ValidatePaginationFailureMode(scrape.PaginationFailureMode); err != nil {
+		log.Fatalf("-pagination-failure-mode 参数错误: %v", err)
+	}
+	if maxMemoryRows < 0 {
+		log.Fatalf("-max-memory-rows 不能为负数，当前值: %d", maxMemoryRows)
+	}
+	if maxMemoryRows > 0 && (!hasFormat("csv") || outputShards > 1) {
+		log.Fatalf("-max-memory-rows 只支持不分片的 csv 输出")
+	}
+	if output.AppendCSV && (!hasFormat("csv") || outputShards > 1 || maxMemoryRows > 0 || output.SortOrder != output.SortNone) {
+		log.Fatalf("-append 只支持不分片、不排序的 csv 输出，不能与 -output-shards、-max-memory-rows 或 -sort 同时使用")
+	}
+	if splitByState && (!hasFormat("csv") || outputShards > 1 || maxMemoryRows > 0 || output.SortOrder != output.SortNone || output.AppendCSV || diffBaseline != "") {
+		log.Fatalf("-split-by-state 需要 csv 输出格式，且不能与 -output-shards、-max-memory-rows、-sort、-append 或 -diff 同时使用")
+	}
+	if diffBaseline != "" && !hasFormat("csv") {
+		log.Fatalf("-diff 需要 csv 输出格式，当前格式: %s", strings.Join(outputFormats, ","))
+	}
+	if diffBaseline != "" && !output.HasColumn("Link") {
+		log.Fatalf("-diff 按 Link 列对比结果，请在 -columns 中加入 Link")
+	}
+	if output.SortOrder != output.SortNone && outputShards > 1 {
+		log.Fatalf("-sort 不能与 -output-shards 同时使用，分片合并后的结果无法保证顺序")
+	}
+	if smartyRecordDir != "" && smartyReplayDir != "" {
+		log.Fatalf("-record-smarty 与 -replay-smarty 不能同时使用")
+	}
+	if resultsFile == "" {
+		log.Fatalf("-output 不能为空")
+	}
+	// 试运行不产生验证结果，同时使用时会清空内容哈希缓存或删除检查点
+	if dryRun && (smartyReplayDir != "" || verifyOnlyChanged || checkpointFile != "") {
+		log.Fatalf("-dry-run 不能与 -replay-smarty、-verify-only-changed 或 -checkpoint 同时使用")
+	}
+	if dryRun {
+		log.Println("试运行模式: 只抓取和写入结果，不会调用 Smarty API，也不会加载或保存凭证，所有地址的 CMRA/RDI 均为 UNKNOWN。")
+	}
+	if smartyReplayDir != "" {
+		log.Printf("回放模式: 将从 %s 读取 Smarty 响应，不会调用 API。", smartyReplayDir)
+	}
+	log.Printf("运行配置: 抓取工作单元 %d 个，验证工作单元 %d 个，凭证文件 %s，结果文件 %s", numATMBWorkers, numScrapyWorkers, configFile, resultsFile)
+}
+
+// workerCount 确定工作单元数量：命令行显式指定了 name 参数时使用 value，
+// 否则在设置了 env 环境变量时使用环境变量的值，都没有时使用 fallback。结果必须大于等于 1。
+func workerCount(name, env string, value, fallback int, explicit map[string]bool) (int, error) {
+	count, source := fallback, "默认值"
+	if explicit[name] {
+		count, source = value, "-"+name
+	} else if s, ok := os.LookupEnv(env); ok && strings.TrimSpace(s) != "" {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return 0, fmt.Errorf("环境变量 %s 不是有效的整数: %q", env, s)
+		}
+		count, source = n, env
+	}
+	if count < 1 {
+		return 0, fmt.Errorf("%s 指定的工作单元数量必须大于等于 1，当前值: %d", source, count)
+	}
+	return count, nil
+}
+
+// 自动配置工作单元时每个 CPU 对应的工作单元数量及上限。
+// 两类工作单元大部分时间都在等待网络，因此数量都大于 CPU 数量；
+// 抓取工作单元受州的数量 (约 56 个) 和站点限流约束，上限较低。
+const (
+	atmbWorkersPerCPU    = 2
+	maxAutoATMBWorkers   = 16
+	smartyWorkersPerCPU  = 4
+	maxAutoSmartyWorkers = 64
+)
+
+// configureWorkers 按 CPU 数量设置抓取和验证工作单元的数量
+func configureWorkers(cpus int) {
+	numATMBWorkers = min(cpus*atmbWorkersPerCPU, maxAutoATMBWorkers)
+	numScrapyWorkers = min(cpus*smartyWorkersPerCPU, maxAutoSmartyWorkers)
+	log.Printf("按 %d 个 CPU 自动配置工作单元: 抓取 %d 个，验证 %d 个。", cpus, numATMBWorkers, numScrapyWorkers)
+}
+
+// hasFormat 判断 -format 中是否包含指定的输出格式
+func hasFormat(format string) bool {
+	return slices.Contains(outputFormats, format)
+}
+
+// outputPath 返回与 -output 同名、扩展名为 ext 的结果文件路径
+func outputPath(ext string) string {
+	return strings.TrimSuffix(resultsFile, filepath.Ext(resultsFile)) + ext
+}
+
+// envOr 返回环境变量 key 的值，未设置或为空时返回 fallback
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"atmb/model"
+)
+
+// inputFields 是输入 CSV 可以映射的地址字段，key 为 -input-mapping 中使用的字段名
+var inputFields = map[string]func(addr *model.Address, value string){
+	"title":     func(a *model.Address, v string) { a.Title = v },
+	"price":     func(a *model.Address, v string) { a.Price, a.PriceCents = v, model.ParsePriceCents(v) },
+	"street":    func(a *model.Address, v string) { a.Street = v },
+	"secondary": func(a *model.Address, v string) { a.Secondary = v },
+	"city":      func(a *model.Address, v string) { a.City = v },
+	"state":     func(a *model.Address, v string) { a.State = v },
+	"zip":       func(a *model.Address, v string) { a.Zip = v },
+	"link":      func(a *model.Address, v string) { a.Link = v },
+}
+
+// requiredInputFields 是验证地址所必需的字段
+var requiredInputFields = []string{"street", "city", "state", "zip"}
+
+// parseInputMapping 解析形如 "street=Address1,city=City" 的字段映射。
+// 未出现在映射中的字段默认使用与字段同名的列 (不区分大小写)。
+func parseInputMapping(value string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, pair := range splitList(value) {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("无效的字段映射 %q，格式应为 field=Column", pair)
+		}
+		if _, known := inputFields[field]; !known {
+			return nil, fmt.Errorf("未知的地址字段 %q", field)
+		}
+		mapping[field] = column
+	}
+	return mapping, nil
+}
+
+// loadInputAddresses 从 CSV 文件读取待验证的地址，mapping 指定地址字段对应的列名
+func loadInputAddresses(filename string, mapping map[string]string) ([]*model.Address, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("打开输入文件失败: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println("loadInputAddresses 文件退出错误: ", err)
+		}
+	}()
+
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析输入CSV失败: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("输入文件 %s 为空", filename)
+	}
+
+	// 将表头列名映射到列索引
+	columnIndex := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		columnIndex[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	fieldIndex := make(map[string]int)
+	for field := range inputFields {
+		column, ok := mapping[field]
+		if !ok {
+			column = field
+		}
+		if i, found := columnIndex[strings.ToLower(column)]; found {
+			fieldIndex[field] = i
+		} else if ok {
+			return nil, fmt.Errorf("输入文件中不存在映射的列 %q (字段 %s)", column, field)
+		}
+	}
+
+	var missing []string
+	for _, field := range requiredInputFields {
+		if _, ok := fieldIndex[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("输入文件缺少必需字段 %s，请使用 -input-mapping 指定对应的列", strings.Join(missing, ", "))
+	}
+
+	addresses := make([]*model.Address, 0, len(records)-1)
+	for _, row := range records[1:] {
+		addr := &model.Address{RDI: "UNKNOWN", CMRA: "UNKNOWN", PriceCents: -1}
+		for field, i := range fieldIndex {
+			if i < len(row) {
+				inputFields[field](addr, strings.TrimSpace(row[i]))
+			}
+		}
+		addresses = append(addresses, addr)
+	}
+	return addresses, nil
+}
@@ -1,108 +1,316 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
-	"sync"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"atmb/credential"
+	"atmb/model"
+	"atmb/output"
+	"atmb/pipeline"
+	"atmb/scrape"
 )
 
-const (
-	configFilename   = "config.json"
+// 工作单元数量，可以通过 -scrapy-workers/-atmb-workers 参数、SCRAPY_WORKERS/ATMB_WORKERS 环境变量
+// 或 -auto-workers 配置，都未设置时使用以下默认值
+var (
 	numScrapyWorkers = 10
 	numATMBWorkers   = 5
 )
 
+// discoverStates 按 -discovery 参数获取州列表，通过 -states/-states-file 指定了州时直接使用指定的州。
+// live 模式下从网站抓取，抓取失败 (或页面中没有州) 时退回到内置的静态列表。
+// 内置列表中的州名总是先被记录，网站返回的州名会覆盖它们 (见 stateNames)。
+func discoverStates(ctx context.Context) []string {
+	static, err := scrape.LoadStaticStates()
+	if err != nil {
+		log.Fatalf("加载内置州列表失败: %v", err)
+	}
+	staticSlugs := registerStateNames(static)
+	slices.Sort(staticSlugs)
+
+	if len(stateList) > 0 {
+		log.Printf("使用 -states/-states-file 指定的 %d 个州，跳过获取州列表。", len(stateList))
+		return stateList
+	}
+	if stateDiscovery == discoveryLive {
+		states, err := scrape.GetState(ctx)
+		if err == nil {
+			return registerStateNames(states)
+		}
+		log.Printf("警告: 无法从网站获取州列表 (%v)，改用内置的静态州列表。", err)
+	}
+	return staticSlugs
+}
+
+// newCredentialSource 按 -credential-source 参数创建凭证来源
+// 指定了 -creds-dir 时，在该来源的凭证之后合并目录中的凭证
+func newCredentialSource() (credential.Source, error) {
+	var source credential.Source
+	switch credentialSource {
+	case sourceFile:
+		source = credential.FileSource{Path: configFile}
+	case sourceVault:
+		vault, err := credential.NewVaultSourceFromEnv(vaultPath)
+		if err != nil {
+			return nil, err
+		}
+		source = vault
+	default:
+		return nil, fmt.Errorf("不支持的凭证来源: %s (可选 %s, %s)", credentialSource, sourceFile, sourceVault)
+	}
+	if credsDir != "" {
+		return &credential.DirSource{Dir: credsDir, Base: source}, nil
+	}
+	return source, nil
+}
+
+// newResultWriter 按 -format 参数创建结果写入器，指定多种格式时同时写入所有格式
+func newResultWriter() output.OutputWriter {
+	if len(outputFormats) == 1 {
+		return newFormatWriter(outputFormats[0])
+	}
+	writers := make([]output.OutputWriter, len(outputFormats))
+	for i, format := range outputFormats {
+		writers[i] = newFormatWriter(format)
+	}
+	return output.MultiWriter{Writers: writers}
+}
+
+// newFormatWriter 创建单一格式的结果写入器，csv 格式按 -split-by-state、-output-shards 和 -max-memory-rows 参数选择写入方式
+func newFormatWriter(format string) output.OutputWriter {
+	switch {
+	case format == "geojson":
+		return output.GeoJSONWriter{Filename: outputPath(".geojson")}
+	case format == "parquet":
+		return output.ParquetWriter{Filename: outputPath(".parquet")}
+	case format == "sqlite":
+		return output.SQLiteWriter{Filename: outputPath(".sqlite")}
+	case format == "jsonl":
+		return output.JSONLWriter{Filename: outputPath(".jsonl")}
+	case format == "xlsx":
+		return output.XLSXWriter{Filename: outputPath(".xlsx")}
+	case splitByState:
+		return output.StateSplitCSVWriter{Dir: outputPath("")}
+	case outputShards > 1:
+		return output.ShardedCSVWriter{Filename: resultsFile, Shards: outputShards}
+	case maxMemoryRows > 0:
+		return output.BoundedCSVWriter{Filename: resultsFile, MaxRows: maxMemoryRows}
+	}
+	return output.CSVWriter{Filename: resultsFile}
+}
+
+// writeDiffReport 对比本次结果与基线结果，并将变化报告写入 diff_report.json
+func writeDiffReport(baseline, current string) {
+	report, err := output.DiffCSV(baseline, current)
+	if err != nil {
+		log.Printf("警告: 无法对比 %s 和 %s: %v", baseline, current, err)
+		return
+	}
+	if err := output.WriteDiffReport("diff_report.json", report); err != nil {
+		log.Printf("警告: %v", err)
+		return
+	}
+	log.Printf("与基线 %s 对比: 新增 %d 个，下架 %d 个，变化 %d 个地点，报告已写入 diff_report.json。",
+		baseline, len(report.Added), len(report.Removed), len(report.Changed))
+}
+
 func main() {
-	// --- 1. 加载并去重州列表 ---
-	states := getState()
-	log.Printf("已加载 %d 个唯一的州进行抓取。", len(states))
+	parseFlags()
+	started := time.Now()
+
+	// rootCtx 是整个运行的根 context，指定 -timeout 时到期后所有请求和工作单元都会停止
+	rootCtx, cancelRoot := context.WithCancel(context.Background())
+	if runTimeout > 0 {
+		rootCtx, cancelRoot = context.WithTimeout(context.Background(), runTimeout)
+	}
+	defer cancelRoot()
+
+	// 自检模式只检查抓取和解析是否正常，不调用 Smarty
+	if selfTestHTML != "" {
+		os.Exit(runSelfTestHTML(selfTestHTML, selfTestState))
+	}
+	if selfTest {
+		os.Exit(runSelfTest(rootCtx, selfTestState))
+	}
+
+	// 去重模式是独立的维护工具，处理完指定文件后直接退出
+	if dedupeFile != "" {
+		removed, err := output.DedupeCSV(dedupeFile)
+		if err != nil {
+			log.Fatalf("去重 %s 失败: %v", dedupeFile, err)
+		}
+		log.Printf("已从 %s 中删除 %d 条重复记录。", dedupeFile, removed)
+		return
+	}
+
+	// --- 1. 加载并去重州列表 (或从输入文件读取待验证的地址) ---
+	var states []string
+	var inputAddresses []*model.Address
+	if inputFile != "" {
+		var err error
+		inputAddresses, err = loadInputAddresses(inputFile, inputMapping)
+		if err != nil {
+			log.Fatalf("读取输入文件 %s 时出错: %v", inputFile, err)
+		}
+		log.Printf("从 %s 中加载 %d 个待验证的地址，跳过抓取。", inputFile, len(inputAddresses))
+	} else {
+		states = skipStates(discoverStates(rootCtx), skipStateList)
+		log.Printf("已加载 %d 个唯一的州进行抓取。", len(states))
+		if stateOrder != nil {
+			states = stateOrder(states)
+			log.Printf("按 -state-order 调整后的州处理顺序: %s", strings.Join(states, ", "))
+		}
+	}
+
+	// --- 2. 加载初始API凭证 (无需检查数量)，试运行模式不调用 Smarty，也不需要凭证 ---
+	source, err := newCredentialSource()
+	if err != nil {
+		log.Fatalf("凭证来源配置错误: %v", err)
+	}
+	var loadedCredentials []credential.ApiCredential
+	if !dryRun {
+		if loadedCredentials, err = source.Load(); err != nil {
+			log.Fatalf("读取凭证 %s 时出错: %v", source, err)
+		}
+		log.Printf("从 %s 中成功加载 %d 组凭证。", source, len(loadedCredentials))
+	}
+
+	var hashCache *pipeline.ContentCache
+	if verifyOnlyChanged {
+		if hashCache, err = pipeline.LoadContentCache(hashCacheFile); err != nil {
+			log.Fatalf("-verify-only-changed 无法加载缓存: %v", err)
+		}
+		log.Printf("从 %s 中加载 %d 个地点的内容哈希。", hashCacheFile, hashCache.Len())
+	}
+
+	var resumeCheckpoint *pipeline.Checkpoint
+	if checkpointFile != "" {
+		if resumeCheckpoint, err = pipeline.OpenCheckpoint(checkpointFile); err != nil {
+			log.Fatalf("-checkpoint 参数错误: %v", err)
+		}
+		if n := resumeCheckpoint.Len(); n > 0 {
+			log.Printf("从检查点 %s 恢复: %d 个地址已在之前的运行中处理完毕，将直接复用结果。", checkpointFile, n)
+		}
+	}
 
-	// --- 2. 加载初始API凭证 (无需检查数量) ---
-	loadedCredentials, err := loadCredentialsFromFile(configFilename)
+	// --- 3. 运行抓取和验证流程 ---
+	resultWriter := newResultWriter()
+	run, err := pipeline.Run(rootCtx, pipeline.Config{
+		States:               states,
+		Addresses:            inputAddresses,
+		Threshold:            threshold.forStates(states),
+		AvailableOnly:        availableOnly,
+		SamplePerState:       samplePerState,
+		Credentials:          loadedCredentials,
+		ValidateCredentials:  !dryRun && !skipValidation && smartyReplayDir == "",
+		MaxLookups:           maxLookups,
+		ATMBWorkers:          numATMBWorkers,
+		SmartyWorkers:        numScrapyWorkers,
+		WorkerRamp:           workerRamp,
+		HTTPClient:           smartyHTTPClient,
+		SDKMaxRetry:          smartyMaxRetry,
+		BatchSize:            smartyBatchSize,
+		BatchTimeout:         smartyBatchTimeout,
+		MatchChain:           matchChain,
+		MaxCandidates:        maxCandidates,
+		SlowThreshold:        slowThreshold,
+		RecordDir:            smartyRecordDir,
+		ReplayDir:            smartyReplayDir,
+		DryRun:               dryRun,
+		AutocompleteFallback: autocompleteFallback,
+		AbbreviateStreet:     abbreviateStreet,
+		MaxRetries:           maxRetries,
+		InitialBackoff:       initialBackoff,
+		MaxBackoff:           maxBackoff,
+		HashCache:            hashCache,
+		Checkpoint:           resumeCheckpoint,
+		Writer:               resultWriter,
+		AppendResults:        output.AppendCSV,
+		OnlyNonCMRA:          onlyNonCMRA,
+		UnknownCMRA:          unknownCMRA,
+		FailedFile:           "failed_results.csv",
+		StreamFailed:         streamFailed,
+		StatusAddr:           statusAddr,
+		ProgressInterval:     progressInterval,
+		ParallelismReport:    parallelismReport,
+		HandleSignals:        true,
+		DrainOnShutdown:      drainOnShutdown,
+		ShutdownGrace:        shutdownGrace,
+	})
 	if err != nil {
-		log.Fatalf("读取配置文件 %s 时出错: %v", configFilename, err)
-	}
-	log.Printf("从 %s 中成功加载 %d 组凭证。", configFilename, len(loadedCredentials))
-
-	apiManager := NewAPIManager(loadedCredentials)
-
-	// --- 3. 设置 Channels 和 WaitGroups ---
-	stateChan := make(chan string, len(states))
-	jobs := make(chan *Address, 1000)
-	results := make(chan *Address, 1000)
-	failedJobs := make(chan *Address, 1000)
-
-	var atmbWg, scrapyWg, csvWriterWg sync.WaitGroup
-
-	// --- 4. 启动地址处理工作单元 (Smarty Workers) ---
-	scrapyWg.Add(numScrapyWorkers)
-	for w := 1; w <= numScrapyWorkers; w++ {
-		go smartyWorker(w, apiManager, jobs, results, failedJobs, &scrapyWg)
-	}
-
-	// --- 5. 启动抓取工作单元 (ATMB Workers) ---
-	atmbWg.Add(numATMBWorkers)
-	for w := 1; w <= numATMBWorkers; w++ {
-		go atmbWorker(w, stateChan, jobs, &atmbWg)
-	}
-
-	// --- 6. 分发抓取任务 ---
-	log.Println("正在分发州名给抓取工作单元...")
-	for _, state := range states {
-		stateChan <- state
-	}
-	close(stateChan)
-
-	// --- 7. 管理 Channel 关闭 (核心改动) ---
-	var shutdownOnce sync.Once
-	// 定义一个函数，用于触发关闭流程，sync.Once 会保证它只被执行一次
-	initiateShutdown := func() {
-		log.Println("检测到关闭信号。关闭 jobs 通道，停止接收新任务。")
-		close(jobs)
-	}
-
-	// 启动一个goroutine，等待抓取完成，然后触发关闭
-	go func() {
-		atmbWg.Wait()
-		log.Println("所有抓取工作单元已完成。")
-		shutdownOnce.Do(initiateShutdown)
-	}()
-
-	// 启动另一个goroutine，等待凭证耗尽的信号，然后触发关闭
-	go func() {
-		// 这会阻塞，直到有 worker 向 failedJobs channel 发送数据
-		<-failedJobs
-		log.Println("检测到凭证耗尽信号。")
-		shutdownOnce.Do(initiateShutdown)
-	}()
-
-	// 启动并发写入CSV文件 (无变化)
-	csvWriterWg.Add(1)
-	go func() {
-		defer csvWriterWg.Done()
-		writeToCSV("results.csv", results)
-	}()
-
-	// --- 8. 等待所有任务完成 ---
-	log.Println("正在等待所有地址处理工作单元完成...")
-	scrapyWg.Wait()
-	log.Println("所有地址处理工作单元已完成。关闭 results 通道。")
-	close(results)
-	close(failedJobs) // 在所有 processor 都退出后，关闭 failedJobs channel
-
-	// --- 将失败的任务写入CSV ---
-	writeFailedToCSV("failed_results.csv", failedJobs)
-
-	// 等待CSV写入完成
-	csvWriterWg.Wait()
-
-	// --- 9. 将更新后的凭证列表保存回文件 ---
-	log.Println("正在将更新后的凭证列表保存回 config.json...")
-	finalCredentials := apiManager.GetAllCredentials()
-	if err := saveCredentialsToFile(configFilename, finalCredentials); err != nil {
-		log.Printf("警告: 无法将新凭证保存到 %s: %v", configFilename, err)
+		log.Fatalf("%v (凭证来源 %s)", err, source)
+	}
+	cause := run.Cause
+
+	if diffBaseline != "" {
+		writeDiffReport(diffBaseline, resultsFile)
+	}
+	if hashCache != nil {
+		if err := hashCache.Save(hashCacheFile, coveredAllLocations(run)); err != nil {
+			log.Printf("警告: %v", err)
+		}
+	}
+	if resumeCheckpoint != nil {
+		if err := resumeCheckpoint.Close(); err != nil {
+			log.Printf("警告: 关闭检查点失败: %v", err)
+		}
+		// 运行完整结束后检查点已无用，删除它，避免下次运行误用过期的结果
+		if cause == pipeline.CauseCompleted {
+			if err := os.Remove(checkpointFile); err != nil {
+				log.Printf("警告: 删除检查点失败: %v", err)
+			} else {
+				log.Printf("运行已完整结束，已删除检查点 %s。", checkpointFile)
+			}
+		} else {
+			log.Printf("运行未完整结束 (%s)，检查点保存在 %s，使用相同的 -checkpoint 重新运行即可跳过已处理的地址。", cause, checkpointFile)
+		}
+	}
+	deviations := 0
+	if expectedCounts != nil {
+		deviations = checkExpectations(newStateCounts(run.StateCounts), expectedCounts, expectTolerance)
+	}
+
+	// --- 4. 将更新后的凭证列表保存回凭证来源 ---
+	// 本地文件总是写回；密钥管理服务只有在显式开启 -credential-write-back 时才写回
+	saver, ok := source.(credential.Saver)
+	if ok && !dryRun && (credentialSource == sourceFile || credentialWriteBack) {
+		log.Printf("正在将更新后的凭证列表保存回 %s...", source)
+		finalCredentials := run.Credentials
+		if err := saver.Save(finalCredentials); err != nil {
+			log.Printf("警告: 无法将新凭证保存到 %s: %v", source, err)
+		} else {
+			log.Printf("已成功将 %d 组凭证保存到 %s。", len(finalCredentials), source)
+		}
+	}
+
+	report := newRunReport(started, run)
+	if report.ExitCode == 0 && deviations > 0 && expectStrict {
+		report.ExitCode = 1
+	}
+	if err := writeRunReport(runReportFile, report); err != nil {
+		log.Printf("警告: %v", err)
 	} else {
-		log.Printf("已成功将 %d 组凭证保存到 %s。", len(finalCredentials), configFilename)
+		log.Printf("运行报告已写入 %s。", runReportFile)
 	}
 
-	log.Println("程序完成。")
+	log.Printf("程序完成。运行结束原因: %s (退出码 %d)", cause, cause.ExitCode())
+	if code := cause.ExitCode(); code != 0 {
+		os.Exit(code)
+	}
+	if deviations > 0 && expectStrict {
+		os.Exit(1)
+	}
+}
+
+// coveredAllLocations 判断本次运行是否完整处理了所有地点：运行正常结束，没有用 -states、-skip-states、
+// -sample-per-state、-available-only 或 -input 缩小范围，也没有抓取失败而被跳过的州
+func coveredAllLocations(run pipeline.Results) bool {
+	return run.Cause == pipeline.CauseCompleted && len(stateList) == 0 && len(skipStateList) == 0 &&
+		samplePerState == 0 && !availableOnly && inputFile == "" && len(run.StateErrors) == 0
 }
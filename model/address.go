@@ -0,0 +1,89 @@
+// Package model 定义在抓取、验证和输出各阶段之间传递的数据结构。
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Address 是从 ATMB 抓取并经 Smarty 验证的单个地址
+type Address struct {
+	// ID 是地址作为任务创建时生成的关联 ID，用于在并发交错的日志中追踪同一地址
+	ID string
+
+	Title, Price, Street, City, State, Zip, Link, RDI, CMRA string
+
+	// Secondary 是二级地址 (如 "Ste 100"、"Unit B"、"#305")，从街道行中拆出；没有时为空
+	Secondary string
+
+	// PriceCents 是以美分表示的月租价格，价格未知时为 -1
+	PriceCents int
+
+	// LocationName 和 Descriptor 由 Title 解析而来，未开启标题解析时为空
+	LocationName, Descriptor string
+
+	// FailReason 记录地址处理失败的原因，只在写入失败任务文件时使用
+	FailReason string
+	// Suggestion 是地址无法验证时 Smarty Autocomplete 给出的建议地址，供人工核对
+	Suggestion string
+
+	// Status 是地点的营业状态：卡片上有即将开业的标记时为 StatusComingSoon，否则为 StatusAvailable；
+	// 不是从 ATMB 页面抓取的地址 (如 -input 输入的地址) 为空，同样视为可租用
+	Status string
+
+	// MatchTier 是验证成功时使用的匹配策略 (如 strict、enhanced)，所有策略都失败时为 unverified
+	MatchTier string
+
+	// Latitude 和 Longitude 来自 Smarty 的验证结果，未验证或无坐标时为 0
+	Latitude, Longitude float64
+
+	// 以下字段同样来自 Smarty 的验证结果，未验证时为空：
+	// County 是县名，Vacant 是 DPV 空置标记 (Y/N)，RecordType 是记录类型 (如 S、H、P)，
+	// CongressionalDistrict 是国会选区编号
+	County, Vacant, RecordType, CongressionalDistrict string
+
+	// Candidates 是 Smarty 为该地址返回的候选地址数量，LowConfidence 表示匹配可能不可靠
+	// (返回了多个候选，或 DPV 没有完全确认该地址)
+	Candidates    int
+	LowConfidence bool
+}
+
+// 地点的营业状态
+const (
+	StatusAvailable  = "available"
+	StatusComingSoon = "coming soon"
+)
+
+// Available 判断地点是否已经可以租用，没有状态标记的地点视为可租用
+func (a *Address) Available() bool {
+	return a.Status != StatusComingSoon
+}
+
+// ContentHash 返回地点卡片内容 (标题、价格、地址和链接) 的哈希，
+// 用于判断 ATMB 上的地点信息自上次运行以来是否发生变化
+func (a *Address) ContentHash() string {
+	h := sha256.New()
+	for _, field := range []string{a.Title, a.Price, a.Street, a.Secondary, a.City, a.State, a.Zip, a.Link} {
+		h.Write([]byte(field))
+		h.Write([]byte{0x1f}) // 字段分隔符，避免不同字段拼接后产生相同的内容
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HasCoordinates 判断地址是否带有有效的经纬度
+func (a *Address) HasCoordinates() bool {
+	return a.Latitude != 0 || a.Longitude != 0
+}
+
+// ParsePriceCents 将 "9.99" 这样的价格文本转换为美分，无法解析时返回 -1
+func ParsePriceCents(price string) int {
+	price = strings.TrimPrefix(strings.TrimSpace(price), "$")
+	value, err := strconv.ParseFloat(strings.ReplaceAll(price, ",", ""), 64)
+	if err != nil || value < 0 {
+		return -1
+	}
+	return int(math.Round(value * 100))
+}
@@ -0,0 +1,197 @@
+package output
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"atmb/model"
+)
+
+// Column 描述输出文件中的一列：列名及如何从地址中取值
+type Column struct {
+	Name  string
+	Value func(addr *model.Address) string
+}
+
+// DefaultColumns 是 CSV 输出默认包含的列
+var DefaultColumns = []Column{
+	{"Title", func(a *model.Address) string { return a.Title }},
+	{"Price", func(a *model.Address) string { return a.Price }},
+	{"Street", func(a *model.Address) string { return a.Street }},
+	{"Secondary", func(a *model.Address) string { return a.Secondary }},
+	{"City", func(a *model.Address) string { return a.City }},
+	{"State", func(a *model.Address) string { return a.State }},
+	{"Zip", func(a *model.Address) string { return a.Zip }},
+	{"Link", func(a *model.Address) string { return a.Link }},
+	{"CMRA", func(a *model.Address) string { return a.CMRA }},
+	{"RDI", func(a *model.Address) string { return a.RDI }},
+}
+
+// StatusColumns 是开启 -status-column 后输出的地点营业状态列
+var StatusColumns = []Column{
+	{"Status", func(a *model.Address) string { return a.Status }},
+}
+
+// TitleColumns 是解析标题后得到的可选列
+var TitleColumns = []Column{
+	{"LocationName", func(a *model.Address) string { return a.LocationName }},
+	{"Descriptor", func(a *model.Address) string { return a.Descriptor }},
+}
+
+// MatchTierColumns 是开启匹配策略链后输出的列
+var MatchTierColumns = []Column{
+	{"MatchTier", func(a *model.Address) string { return a.MatchTier }},
+}
+
+// ConfidenceColumns 是开启多候选查询后输出的列
+var ConfidenceColumns = []Column{
+	{"Candidates", func(a *model.Address) string { return strconv.Itoa(a.Candidates) }},
+	{"LowConfidence", func(a *model.Address) string { return strconv.FormatBool(a.LowConfidence) }},
+}
+
+// SmartyFieldColumns 是可以通过 -smarty-fields 选择输出的 Smarty 验证结果字段，key 为字段名
+var SmartyFieldColumns = map[string]Column{
+	"county":                 {"County", func(a *model.Address) string { return a.County }},
+	"latitude":               {"Latitude", func(a *model.Address) string { return formatCoordinate(a, a.Latitude) }},
+	"longitude":              {"Longitude", func(a *model.Address) string { return formatCoordinate(a, a.Longitude) }},
+	"vacant":                 {"Vacant", func(a *model.Address) string { return a.Vacant }},
+	"record_type":            {"RecordType", func(a *model.Address) string { return a.RecordType }},
+	"congressional_district": {"CongressionalDistrict", func(a *model.Address) string { return a.CongressionalDistrict }},
+}
+
+// smartyFieldNames 是 SmartyFieldColumns 中的字段名，用于错误提示
+var smartyFieldNames = []string{"county", "latitude", "longitude", "vacant", "record_type", "congressional_district"}
+
+// ParseSmartyFields 解析逗号分隔的 Smarty 字段列表，按给定顺序返回对应的列
+func ParseSmartyFields(value string) ([]Column, error) {
+	var columns []Column
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" || seen[name] {
+			continue
+		}
+		col, ok := SmartyFieldColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("不支持的 Smarty 字段: %s (可选 %s)", part, strings.Join(smartyFieldNames, ", "))
+		}
+		seen[name] = true
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+// failureColumns 是失败任务文件在结果列之后附加的列
+var failureColumns = []Column{
+	{"FailReason", func(a *model.Address) string { return a.FailReason }},
+	{"Suggestion", func(a *model.Address) string { return a.Suggestion }},
+}
+
+// selectableColumns 返回 -columns 可以选择的所有列，按默认列、可选列的顺序排列
+func selectableColumns() []Column {
+	columns := slices.Concat(DefaultColumns, StatusColumns, TitleColumns, MatchTierColumns, ConfidenceColumns)
+	for _, name := range smartyFieldNames {
+		columns = append(columns, SmartyFieldColumns[name])
+	}
+	return append(columns, failureColumns...)
+}
+
+// ParseColumns 解析 -columns 参数：逗号分隔的列名 (不区分大小写)，按给定顺序返回对应的列
+func ParseColumns(value string) ([]Column, error) {
+	available := selectableColumns()
+	byName := make(map[string]Column, len(available))
+	for _, col := range available {
+		byName[strings.ToLower(col.Name)] = col
+	}
+
+	var columns []Column
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(value, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+		col, ok := byName[name]
+		if !ok {
+			names := make([]string, len(available))
+			for i, col := range available {
+				names[i] = col.Name
+			}
+			return nil, fmt.Errorf("未知的列 %q (可选 %s)", strings.TrimSpace(part), strings.Join(names, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("列 %s 重复出现", col.Name)
+		}
+		seen[name] = true
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("至少需要选择一列")
+	}
+	return columns, nil
+}
+
+// HasColumn 判断当前的列配置中是否包含名为 name 的列
+func HasColumn(name string) bool {
+	return slices.Contains(header(), name)
+}
+
+// formatCoordinate 格式化经纬度，地址没有坐标时返回空字符串
+func formatCoordinate(a *model.Address, value float64) string {
+	if !a.HasCoordinates() {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// Columns 是 CSV 输出实际使用的列，调用方可以在开始写入前追加可选列
+var Columns = DefaultColumns
+
+// header 返回当前列配置下的表头
+func header() []string {
+	names := make([]string, len(Columns))
+	for i, col := range Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// record 返回地址在当前列配置下的一行数据
+func record(addr *model.Address) []string {
+	values := make([]string, len(Columns))
+	for i, col := range Columns {
+		values[i] = col.Value(addr)
+	}
+	return values
+}
+
+// failedHeader 返回失败任务文件的表头，在结果列之后附加失败原因和建议地址 (已通过 -columns 选择的除外)
+func failedHeader() []string {
+	names := header()
+	for _, col := range extraFailureColumns() {
+		names = append(names, col.Name)
+	}
+	return names
+}
+
+// failedRecord 返回失败任务文件中的一行数据
+func failedRecord(addr *model.Address) []string {
+	values := record(addr)
+	for _, col := range extraFailureColumns() {
+		values = append(values, col.Value(addr))
+	}
+	return values
+}
+
+// extraFailureColumns 返回失败任务文件需要在结果列之后附加的列
+func extraFailureColumns() []Column {
+	var extra []Column
+	for _, col := range failureColumns {
+		if !HasColumn(col.Name) {
+			extra = append(extra, col)
+		}
+	}
+	return extra
+}
@@ -0,0 +1,554 @@
+// Package output 负责将处理结果写入文件。
+package output
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"atmb/model"
+)
+
+// AppendCSV 为 true 时，流式写入的结果追加到已有的 CSV 文件末尾，只有新文件或空文件才写入表头。
+// 备用文件总是新建的，不受影响。
+var AppendCSV bool
+
+// WriteToCSV 将成功处理的地址写入CSV文件。
+// 未指定排序时，结果到达后立即逐行写入，内存中只保留尚未刷新到文件的少量结果；
+// 需要排序时先缓冲全部结果 (结果集非常巨大时可以使用 WriteBoundedCSV)。
+// 它具有强大的容错机制：
+// 1. 尝试写入指定的主文件。
+// 2. 如果失败，则将尚未写入的结果写入一个带时间戳的备用文件。
+// 3. 如果再次失败，则将剩余数据打印到控制台，以防丢失，并返回错误。
+func WriteToCSV(filename string, results <-chan *model.Address) error {
+	_, err := writeCSVTo(filename, fallbackFilename(filename), results)
+	return err
+}
+
+// writeCSVTo 与 WriteToCSV 相同，但使用指定的备用文件名，并按顺序返回实际写入了结果的文件
+// (主文件中途失败时，结果分布在主文件和备用文件中)。没有结果时返回空列表。
+func writeCSVTo(filename, fallback string, results <-chan *model.Address) ([]string, error) {
+	if SortOrder == SortNone {
+		return streamCSVTo(filename, fallback, results)
+	}
+
+	// 排序需要全部结果，只能先将 channel 中的所有结果收集到内存中
+	addresses := collect(results)
+
+	// 如果没有结果，则直接返回，无需创建空文件。
+	if len(addresses) == 0 {
+		log.Println("没有需要写入CSV的结果。")
+		return nil, nil
+	}
+	return writeAddressesTo(filename, fallback, addresses)
+}
+
+// writeAddresses 将已缓冲的地址写入CSV文件，失败时依次尝试备用文件和控制台
+func writeAddresses(filename string, addresses []*model.Address) error {
+	_, err := writeAddressesTo(filename, fallbackFilename(filename), addresses)
+	return err
+}
+
+// writeAddressesTo 与 writeAddresses 相同，但使用指定的备用文件名，并按顺序返回实际写入了结果的文件
+func writeAddressesTo(filename, fallback string, addresses []*model.Address) ([]string, error) {
+	log.Printf("所有地址处理完毕。准备将 %d 条结果写入CSV文件...", len(addresses))
+
+	// written 记录已确认落盘的行数。主文件中途写入失败时，备用文件只写入剩余的行，
+	// 避免同一行同时出现在两个文件中，也不会遗漏任何一行。
+	// files 记录写入过结果的文件：write 第一次调用时写入主文件，第二次调用时写入备用文件
+	written, calls := 0, 0
+	var files []string
+	write := func(w io.Writer) error {
+		name := filename
+		if calls++; calls > 1 {
+			name = fallback
+		}
+		n, err := writeRows(w, addresses[written:])
+		if n > 0 || err == nil {
+			files = append(files, name)
+		}
+		written += n
+		if err != nil {
+			log.Printf("错误: 写入 CSV 时失败 (已写入 %d/%d 行): %v", written, len(addresses), err)
+		}
+		return err
+	}
+	// 以CSV格式打印尚未写入的结果
+	dump := func(w io.Writer) error {
+		_, err := writeRows(w, addresses[written:])
+		return err
+	}
+	return files, writeWithFallbackTo(filename, fallback, write, dump)
+}
+
+// flushEvery 是流式写入时每写入多少行刷新一次文件
+const flushEvery = 100
+
+// streamCSVTo 在第一条结果到达时创建文件，之后每收到一条结果就写入一行。
+// 主文件无法创建或中途写入失败时，尚未确认落盘的行和之后的结果改为写入备用文件 fallback；
+// 备用文件也失败时，剩余结果在通道关闭后打印到控制台。返回按顺序实际写入了结果的文件。
+func streamCSVTo(filename, fallback string, results <-chan *model.Address) ([]string, error) {
+	first, ok := <-results
+	if !ok {
+		log.Println("没有需要写入CSV的结果。")
+		return nil, nil
+	}
+
+	// pending 是尚未确认写入任何文件的结果
+	pending := []*model.Address{first}
+	var lastErr error
+	var files []string
+	for i, name := range []string{filename, fallback} {
+		if i > 0 {
+			log.Printf("警告: 写入主文件 '%s' 失败 (%v)。正在尝试将剩余结果写入备用文件 %s...", filename, lastErr, name)
+		}
+		stream, err := openCSVStream(name, AppendCSV && i == 0)
+		if err == nil {
+			pending, err = stream.stream(pending, results)
+			if stream.rows > 0 {
+				files = append(files, name)
+			}
+			if err == nil {
+				log.Printf("%d 条结果已成功写入 %s 文件。", stream.rows, name)
+				return files, nil
+			}
+		}
+		lastErr = err
+	}
+	log.Printf("错误: 写入备用文件时也失败了: %v", lastErr)
+
+	for addr := range results {
+		pending = append(pending, addr)
+	}
+	log.Println("!!严重警告!! 文件写入彻底失败。为防止数据丢失，将把剩余结果打印到控制台。")
+	log.Println("--- 数据开始 ---")
+	if _, err := writeRows(os.Stdout, pending); err != nil {
+		log.Printf("打印结果失败: %v", err)
+	}
+	log.Println("--- 数据结束 ---")
+	return files, fmt.Errorf("写入 %s 和备用文件均失败: %w", filename, lastErr)
+}
+
+// csvStream 是一个正在流式写入的 CSV 文件。
+// 两次刷新之间的行只缓冲在内存中，刷新时一次写入文件，这样失败时文件中不会残留一部分未确认的行。
+type csvStream struct {
+	file *os.File
+	// writer 把行写入 buf，flush 时再把 buf 写入文件
+	writer *csv.Writer
+	buf    bytes.Buffer
+	// record 将地址转换为一行，flushEvery 是每写入多少行刷新一次文件
+	record     func(addr *model.Address) []string
+	flushEvery int
+	// unflushed 是自上次刷新以来写入的行，刷新失败时需要写入其他文件
+	unflushed []*model.Address
+	rows      int   // 已确认落盘的行数 (不含表头)
+	size      int64 // 已确认落盘的文件大小，刷新失败时把文件截断到这里
+}
+
+// newCSVStream 创建写入 file 的 csvStream，size 是文件中已有内容的大小
+func newCSVStream(file *os.File, size int64, record func(addr *model.Address) []string, flushEvery int) *csvStream {
+	s := &csvStream{file: file, record: record, flushEvery: flushEvery, size: size}
+	s.writer = newCSVWriter(&s.buf)
+	return s
+}
+
+// openCSVStream 创建文件并写入表头。
+// appendMode 为 true 时打开已有文件以追加结果，文件已有内容时不再写入表头。
+func openCSVStream(filename string, appendMode bool) (*csvStream, error) {
+	writeHeader := true
+	if appendMode {
+		var err error
+		if writeHeader, err = prepareAppend(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	var size int64
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	s := newCSVStream(file, size, record, flushEvery)
+	if !writeHeader {
+		return s, nil
+	}
+	if err := s.writeHeader(header()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// openFailedCSVStream 创建失败任务文件并写入表头。每写入一行就刷新一次，程序被中断时已写入的失败任务不会丢失。
+func openFailedCSVStream(filename string) (*csvStream, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := newCSVStream(file, 0, failedRecord, 1)
+	if err := s.writeHeader(failedHeader()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// writeHeader 写入并刷新表头，失败时关闭文件
+func (s *csvStream) writeHeader(header []string) error {
+	err := s.writer.Write(header)
+	if err == nil {
+		err = s.flush()
+	}
+	if err != nil {
+		s.file.Close()
+		return fmt.Errorf("写入CSV表头失败: %w", err)
+	}
+	return nil
+}
+
+// prepareAppend 检查追加写入的目标文件，返回是否需要写入表头。
+// 已有文件的表头必须与当前的列配置一致，否则追加的行会与表头错位。
+// 上次写入到一半的行没有换行符，先补上，避免新记录接在它后面。
+func prepareAppend(filename string) (bool, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("读取已有的CSV文件失败: %w", err)
+	}
+
+	existing, err := newCSVReader(bytes.NewReader(data)).Read()
+	if err != nil {
+		return false, fmt.Errorf("读取已有CSV文件 %s 的表头失败: %w", filename, err)
+	}
+	if !slices.Equal(existing, header()) {
+		return false, fmt.Errorf("已有CSV文件 %s 的表头 (%s) 与当前的列 (%s) 不一致，无法追加",
+			filename, strings.Join(existing, ","), strings.Join(header(), ","))
+	}
+	if data[len(data)-1] != '\n' {
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return false, err
+		}
+		_, err = f.Write([]byte("\n"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return false, fmt.Errorf("修复CSV文件末尾的换行失败: %w", err)
+		}
+	}
+	return false, nil
+}
+
+// stream 先写入 pending，再写入 results 中陆续到达的结果，直到通道关闭后关闭文件。
+// 写入失败时关闭文件并返回尚未确认落盘的结果，通道中剩余的结果留给调用方继续处理。
+func (s *csvStream) stream(pending []*model.Address, results <-chan *model.Address) ([]*model.Address, error) {
+	for i, addr := range pending {
+		if err := s.write(addr); err != nil {
+			return s.abort(pending[i+1:]), err
+		}
+	}
+	for addr := range results {
+		if err := s.write(addr); err != nil {
+			return s.abort(nil), err
+		}
+	}
+	return s.close()
+}
+
+// close 刷新剩余的行并关闭文件，失败时返回尚未确认落盘的行
+func (s *csvStream) close() ([]*model.Address, error) {
+	err := s.flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return s.unflushed, err
+	}
+	return nil, nil
+}
+
+// write 写入一行，每 s.flushEvery 行刷新一次文件
+func (s *csvStream) write(addr *model.Address) error {
+	s.unflushed = append(s.unflushed, addr)
+	if err := s.writer.Write(s.record(addr)); err != nil {
+		return err
+	}
+	if len(s.unflushed) >= s.flushEvery {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush 将缓冲的行写入文件，成功后这些行视为已落盘。
+// 只写入了一部分时把文件截断回上次刷新的位置，这些行全部留给调用方写入其他文件，不会重复。
+func (s *csvStream) flush() error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return err
+	}
+	n, err := s.file.Write(s.buf.Bytes())
+	s.buf.Reset()
+	if err != nil {
+		if n > 0 {
+			if truncErr := s.file.Truncate(s.size); truncErr != nil {
+				log.Printf("警告: 无法删除 %s 中写入了一部分的行: %v", s.file.Name(), truncErr)
+			}
+		}
+		return err
+	}
+	s.size += int64(n)
+	s.rows += len(s.unflushed)
+	s.unflushed = s.unflushed[:0]
+	return nil
+}
+
+// abort 在写入失败后关闭文件，返回尚未确认落盘的行以及 rest
+func (s *csvStream) abort(rest []*model.Address) []*model.Address {
+	if err := s.file.Close(); err != nil {
+		log.Println("关闭CSV文件失败: ", err)
+	}
+	return append(s.unflushed, rest...)
+}
+
+// writeRows 写入表头和 rows，每写一行都立即刷新到文件，
+// 返回已确认写入的行数 (不含表头)，以便调用方在失败后从断点继续。
+func writeRows(w io.Writer, rows []*model.Address) (int, error) {
+	writer := newCSVWriter(w)
+	if err := writer.Write(header()); err != nil {
+		return 0, fmt.Errorf("写入CSV表头失败: %w", err)
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return 0, fmt.Errorf("写入CSV表头失败: %w", err)
+	}
+
+	for i, addr := range rows {
+		if err := writer.Write(record(addr)); err != nil {
+			return i, fmt.Errorf("写入第 %d 行失败: %w", i+1, err)
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return i, fmt.Errorf("写入第 %d 行失败: %w", i+1, err)
+		}
+	}
+	return len(rows), nil
+}
+
+// WriteFailedToCSV 在通道关闭后将因凭证耗尽等原因未能处理的任务统一写入CSV文件，没有失败任务时不创建文件。
+// 容错方式与 WriteToCSV 相同：主文件失败时写入带时间戳的备用文件，再失败时打印到控制台。
+// 这里的失败不会终止程序，结果文件和运行总结不受影响。
+func WriteFailedToCSV(filename string, failedJobs <-chan *model.Address) {
+	// 将 channel 中剩余的任务收集起来
+	var failedAddresses []*model.Address
+	for addr := range failedJobs {
+		failedAddresses = append(failedAddresses, addr)
+	}
+
+	// 如果 channel 中没有数据，则不创建文件
+	if len(failedAddresses) == 0 {
+		return
+	}
+
+	log.Printf("检测到 %d 个处理失败的任务，正在写入 %s...", len(failedAddresses), filename)
+
+	write := func(w io.Writer) error {
+		writer := newCSVWriter(w)
+		if err := writer.Write(failedHeader()); err != nil {
+			return fmt.Errorf("写入失败任务CSV表头失败: %w", err)
+		}
+		for _, addr := range failedAddresses {
+			if err := writer.Write(failedRecord(addr)); err != nil {
+				return fmt.Errorf("写入失败记录失败: %w", err)
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	if err := writeWithFallbackTo(filename, failedFallbackFilename(), write, write); err != nil {
+		log.Printf("错误: 失败任务未能写入文件，已打印到控制台: %v", err)
+	}
+}
+
+// WriteShardedCSV 将结果按 Link 哈希分发给 shards 个写入协程，
+// 每个协程写入独立的 results_shard_N.csv 文件，全部完成后再合并为 filename。
+// 分片文件写入失败时，该分片剩余的结果写入它自己的备用文件 (见 shardFallbackFilename)，合并时一并读取。
+// 合并成功后删除分片文件和分片的备用文件；合并失败时保留它们，以防数据丢失。
+// 任一分片或合并失败时返回错误。
+func WriteShardedCSV(filename string, results <-chan *model.Address, shards int) error {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	shardChans := make([]chan *model.Address, shards)
+	// shardFiles 记录每个分片实际写入了结果的文件 (分片文件和/或它的备用文件)
+	names := make([]string, shards)
+	shardFiles := make([][]string, shards)
+	shardErrs := make([]error, shards)
+	var wg sync.WaitGroup
+	wg.Add(shards)
+	for i := range shardChans {
+		shardChans[i] = make(chan *model.Address, 100)
+		names[i] = fmt.Sprintf("%s_shard_%d%s", base, i, ext)
+		go func(i int) {
+			defer wg.Done()
+			shardFiles[i], shardErrs[i] = writeCSVTo(names[i], shardFallbackFilename(filename, i), shardChans[i])
+		}(i)
+	}
+
+	// 按 Link 哈希分发，保证同一地址总是落在同一个分片
+	for addr := range results {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(addr.Link))
+		shardChans[h.Sum32()%uint32(shards)] <- addr
+	}
+	for _, ch := range shardChans {
+		close(ch)
+	}
+	wg.Wait()
+	if err := errors.Join(shardErrs...); err != nil {
+		return fmt.Errorf("写入分片文件失败: %w", err)
+	}
+
+	files := slices.Concat(shardFiles...)
+	if err := mergeCSVShards(filename, files); err != nil {
+		log.Printf("错误: 合并分片文件失败，分片文件已保留: %v", err)
+		return fmt.Errorf("合并分片文件失败: %w", err)
+	}
+	// 写入失败的分片文件中可能只有表头，不在 files 中，同样需要删除
+	for _, name := range slices.Concat(names, files) {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Printf("警告: 删除分片文件 %s 失败: %v", name, err)
+		}
+	}
+	log.Printf("已将 %d 个分片合并写入 %s 文件。", shards, filename)
+	return nil
+}
+
+// shardFallbackFilename 返回第 shard 个分片的备用文件名，如 results_fallback_20060102150405_shard_0.csv。
+// 每个分片使用独立的备用文件，多个分片同时失败时不会写入同一个文件。
+func shardFallbackFilename(filename string, shard int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s_shard_%d%s", strings.TrimSuffix(fallbackFilename(filename), ext), shard, ext)
+}
+
+// mergeCSVShards 将多个带表头的 CSV 分片合并为一个文件，只保留一次表头。
+// shardFiles 是各分片实际写入的文件，任一文件无法读取时返回错误，不会遗漏该分片的结果。
+func mergeCSVShards(filename string, shardFiles []string) error {
+	out, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("创建合并文件失败: %w", err)
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			log.Println("mergeCSVShards 文件退出错误: ", err)
+		}
+	}()
+
+	writer := newCSVWriter(out)
+	headerWritten := false
+	for _, name := range shardFiles {
+		records, err := readCSVFile(name)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		if !headerWritten {
+			if err := writer.Write(records[0]); err != nil {
+				return fmt.Errorf("写入CSV表头失败: %w", err)
+			}
+			headerWritten = true
+		}
+		if err := writer.WriteAll(records[1:]); err != nil {
+			return fmt.Errorf("写入分片 %s 失败: %w", name, err)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// readCSVFile 读取整个 CSV 文件
+func readCSVFile(name string) ([][]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println("readCSVFile 文件退出错误: ", err)
+		}
+	}()
+	records, err := newCSVReader(f).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("读取 %s 失败: %w", name, err)
+	}
+	return records, nil
+}
+
+// StreamFailedToCSV 在失败任务到达时逐条写入CSV文件并立即刷新，
+// 即使程序被意外终止，已经产生的失败任务也会保存在文件中。没有失败任务时不创建文件。
+// 容错方式与 WriteToCSV 的流式写入相同：文件无法创建或中途写入失败时，尚未落盘的和之后的失败任务
+// 改为写入带时间戳的备用文件；备用文件也失败时，在通道关闭后打印到控制台。
+func StreamFailedToCSV(filename string, failedJobs <-chan *model.Address) {
+	first, ok := <-failedJobs
+	if !ok {
+		return
+	}
+
+	// pending 是尚未确认写入任何文件的失败任务
+	pending := []*model.Address{first}
+	var lastErr error
+	for i, name := range []string{filename, failedFallbackFilename()} {
+		if i > 0 {
+			log.Printf("警告: 写入失败任务文件 '%s' 失败 (%v)。正在尝试将剩余的失败任务写入备用文件 %s...", filename, lastErr, name)
+		}
+		stream, err := openFailedCSVStream(name)
+		if err == nil {
+			if pending, err = stream.stream(pending, failedJobs); err == nil {
+				log.Printf("已将 %d 个失败的任务逐条写入 %s 文件。", stream.rows, name)
+				return
+			}
+		}
+		lastErr = err
+	}
+	log.Printf("错误: 写入失败任务的备用文件时也失败了: %v", lastErr)
+
+	for addr := range failedJobs {
+		pending = append(pending, addr)
+	}
+	log.Println("!!严重警告!! 失败任务文件写入彻底失败。为防止数据丢失，将把剩余的失败任务打印到控制台。")
+	log.Println("--- 数据开始 ---")
+	writer := newCSVWriter(os.Stdout)
+	_ = writer.Write(failedHeader())
+	for _, addr := range pending {
+		_ = writer.Write(failedRecord(addr))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Printf("打印失败任务失败: %v", err)
+	}
+	log.Println("--- 数据结束 ---")
+}
+
+// failedFallbackFilename 返回失败任务的备用文件名
+func failedFallbackFilename() string {
+	return fmt.Sprintf("failed_results_fallback_%s.csv", time.Now().Format("20060102150405"))
+}
@@ -0,0 +1,92 @@
+package output
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"atmb/model"
+)
+
+// testAddresses 返回 n 个 Link 各不相同的地址
+func testAddresses(n int) []*model.Address {
+	addrs := make([]*model.Address, n)
+	for i := range addrs {
+		addrs[i] = &model.Address{
+			Street: fmt.Sprintf("%d Main St", i+1), City: "Austin", State: "TX", Zip: "78701",
+			Link: fmt.Sprintf("https://example.com/%d", i+1), CMRA: "N", RDI: "Commercial",
+		}
+	}
+	return addrs
+}
+
+// sendAll 返回一个依次发送 addrs 后关闭的通道
+func sendAll(addrs []*model.Address) <-chan *model.Address {
+	ch := make(chan *model.Address, len(addrs))
+	for _, addr := range addrs {
+		ch <- addr
+	}
+	close(ch)
+	return ch
+}
+
+// readLinks 读取 CSV 文件，检查表头并返回每一行的 Link
+func readLinks(t *testing.T, name string) []string {
+	t.Helper()
+	records, err := readCSVFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 || !slices.Equal(records[0], header()) {
+		t.Fatalf("%s 的表头不正确: %v", name, records)
+	}
+	col := slices.Index(header(), "Link")
+	links := make([]string, 0, len(records)-1)
+	for _, record := range records[1:] {
+		links = append(links, record[col])
+	}
+	return links
+}
+
+func TestWriteShardedCSVReadsShardFallback(t *testing.T) {
+	// 备用文件写入当前目录
+	t.Chdir(t.TempDir())
+	// 同名目录使第 0 个分片文件无法创建，该分片的结果只能写入备用文件
+	if err := os.Mkdir("results_shard_0.csv", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	addrs := testAddresses(50)
+	if err := WriteShardedCSV("results.csv", sendAll(addrs), 3); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readLinks(t, "results.csv")
+	var want []string
+	for _, addr := range addrs {
+		want = append(want, addr.Link)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("合并后有 %d 行，want %d 行 (不重复、不遗漏)", len(got), len(want))
+	}
+	if leftover, _ := filepath.Glob("results_*"); len(leftover) != 0 {
+		t.Errorf("合并后应删除分片文件和分片的备用文件，剩余 %v", leftover)
+	}
+}
+
+func TestStatusColumnOptIn(t *testing.T) {
+	if slices.ContainsFunc(DefaultColumns, func(col Column) bool { return col.Name == "Status" }) {
+		t.Error("默认列不应包含 Status，否则会改变已有 results.csv 的表头")
+	}
+	columns, err := ParseColumns("Link,Status")
+	if err != nil {
+		t.Fatalf("ParseColumns() 返回错误: %v", err)
+	}
+	if got := columns[1].Value(&model.Address{Status: model.StatusComingSoon}); got != model.StatusComingSoon {
+		t.Errorf("Status 列的值 = %q, want %q", got, model.StatusComingSoon)
+	}
+}
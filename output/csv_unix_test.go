@@ -0,0 +1,95 @@
+//go:build unix
+
+package output
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+
+	"atmb/model"
+)
+
+func TestStreamCSVFallbackAfterMidStreamFailure(t *testing.T) {
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "results.csv")
+	fallback := filepath.Join(dir, "results_fallback.csv")
+	// 主文件是一个命名管道：读取端收到前 flushEvery 行后关闭，之后的写入都会失败
+	if err := syscall.Mkfifo(primary, 0644); err != nil {
+		t.Skipf("无法创建命名管道: %v", err)
+	}
+
+	written := make(chan []string, 1)
+	go func() {
+		f, err := os.Open(primary)
+		if err != nil {
+			written <- nil
+			return
+		}
+		defer f.Close()
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for len(lines) < flushEvery+1 && scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		written <- lines
+	}()
+
+	addrs := testAddresses(flushEvery + 30)
+	results := make(chan *model.Address)
+	type outcome struct {
+		files []string
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		files, err := streamCSVTo(primary, fallback, results)
+		done <- outcome{files, err}
+	}()
+
+	// 第 flushEvery 行触发刷新，等读取端收到这些行并关闭管道后再发送剩余的行
+	for _, addr := range addrs[:flushEvery] {
+		results <- addr
+	}
+	lines := <-written
+	if len(lines) != flushEvery+1 {
+		t.Fatalf("主文件收到 %d 行，want 表头和 %d 行", len(lines), flushEvery)
+	}
+	for _, addr := range addrs[flushEvery:] {
+		results <- addr
+	}
+	close(results)
+	got := <-done
+	if got.err != nil {
+		t.Fatalf("streamCSVTo() error = %v", got.err)
+	}
+	if !slices.Equal(got.files, []string{primary, fallback}) {
+		t.Errorf("files = %v, want [%s %s]", got.files, primary, fallback)
+	}
+
+	var want []string
+	for _, addr := range addrs {
+		want = append(want, addr.Link)
+	}
+	records, err := newCSVReader(strings.NewReader(strings.Join(lines, "\n"))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := slices.Index(header(), "Link")
+	var primaryLinks []string
+	for _, record := range records[1:] {
+		primaryLinks = append(primaryLinks, record[col])
+	}
+	if !slices.Equal(primaryLinks, want[:flushEvery]) {
+		t.Errorf("主文件有 %d 行，want 前 %d 行", len(primaryLinks), flushEvery)
+	}
+	// 备用文件恰好是主文件中没有刷新的行：不重复，也不遗漏
+	fallbackLinks := readLinks(t, fallback)
+	if !slices.Equal(fallbackLinks, want[flushEvery:]) {
+		t.Errorf("备用文件有 %d 行，want 主文件中没有刷新的 %d 行", len(fallbackLinks), len(want)-flushEvery)
+	}
+}
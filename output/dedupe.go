@@ -0,0 +1,107 @@
+package output
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dedupeKeyColumns 是去重时依次尝试的键列，使用表头中第一个存在的列
+var dedupeKeyColumns = []string{"LocationID", "Link"}
+
+// keyColumnIndex 返回表头中第一个存在的键列的位置，没有可用的键列时返回 -1
+func keyColumnIndex(header []string) int {
+	for _, name := range dedupeKeyColumns {
+		if i := columnIndex(header, name); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// columnIndex 返回表头中名为 name 的列 (忽略大小写和首尾空白) 的位置，不存在时返回 -1
+func columnIndex(header []string, name string) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.TrimSpace(column), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// DedupeCSV 读取结果 CSV，按 LocationID (不存在时按 Link) 删除重复行并原地重写文件，
+// 保留每个键第一次出现的行。重写先写入同目录下的临时文件再重命名，保证原子性。
+// 返回删除的重复行数。
+func DedupeCSV(filename string) (int, error) {
+	records, err := readCSVFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	keyIndex := keyColumnIndex(records[0])
+	if keyIndex < 0 {
+		return 0, fmt.Errorf("%s 中没有可用于去重的列 (%s)", filename, strings.Join(dedupeKeyColumns, " 或 "))
+	}
+
+	seen := make(map[string]bool, len(records))
+	kept := [][]string{records[0]}
+	for _, row := range records[1:] {
+		key := ""
+		if keyIndex < len(row) {
+			key = strings.TrimSpace(row[keyIndex])
+		}
+		// 没有键的行无法判断是否重复，全部保留
+		if key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		kept = append(kept, row)
+	}
+
+	removed := len(records) - len(kept)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".dedupe-*")
+	if err != nil {
+		return 0, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		// 重命名成功后临时文件已不存在，这里只清理失败时的残留
+		if err := os.Remove(tmpName); err != nil && !os.IsNotExist(err) {
+			log.Println("DedupeCSV 清理临时文件错误: ", err)
+		}
+	}()
+
+	writer := newCSVWriter(tmp)
+	if err := writer.WriteAll(kept); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("写入临时文件失败: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return 0, fmt.Errorf("同步临时文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("关闭临时文件失败: %w", err)
+	}
+	// CreateTemp 创建的文件权限为 0600，保留原文件的权限
+	if info, err := os.Stat(filename); err == nil {
+		if err := os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+			log.Println("DedupeCSV 设置文件权限错误: ", err)
+		}
+	}
+	if err := os.Rename(tmpName, filename); err != nil {
+		return 0, fmt.Errorf("替换 %s 失败: %w", filename, err)
+	}
+	return removed, nil
+}
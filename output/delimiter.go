@@ -0,0 +1,50 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// Delimiter 是写入和读取结果 CSV (包括失败任务文件) 时使用的字段分隔符，默认为逗号。
+// 字段中包含分隔符、引号或换行时，encoding/csv 仍会按规则为该字段加上引号，不会破坏列的对齐。
+var Delimiter = ','
+
+// delimiterNames 是 ParseDelimiter 接受的分隔符别名
+var delimiterNames = map[string]rune{
+	"comma":     ',',
+	"tab":       '\t',
+	`\t`:        '\t',
+	"semicolon": ';',
+	"pipe":      '|',
+}
+
+// ParseDelimiter 解析 -delimiter 参数：单个字符，或者 comma、tab (也可以写成 \t)、semicolon、pipe 等别名
+func ParseDelimiter(value string) (rune, error) {
+	if r, ok := delimiterNames[value]; ok {
+		return r, nil
+	}
+	r, size := utf8.DecodeRuneInString(value)
+	if value == "" || size != len(value) || r == utf8.RuneError {
+		return 0, fmt.Errorf("分隔符必须是单个字符或 comma、tab、semicolon、pipe 之一，当前值: %q", value)
+	}
+	if r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("不能使用 %q 作为分隔符", r)
+	}
+	return r, nil
+}
+
+// newCSVWriter 创建使用 Delimiter 作为分隔符的 csv.Writer
+func newCSVWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = Delimiter
+	return writer
+}
+
+// newCSVReader 创建使用 Delimiter 作为分隔符的 csv.Reader，用于读取本程序写入的结果文件
+func newCSVReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = Delimiter
+	return reader
+}
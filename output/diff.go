@@ -0,0 +1,132 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// diffFields 是判断同一地点是否发生变化时比较的列
+var diffFields = []string{"Price", "CMRA"}
+
+// FieldChange 记录某一列在两次运行之间的新旧值
+type FieldChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// ChangedLocation 描述两次运行中都存在、但价格或 CMRA 状态发生变化的地点
+type ChangedLocation struct {
+	Key     string                 `json:"key"`
+	Row     map[string]string      `json:"row"`
+	Changes map[string]FieldChange `json:"changes"`
+}
+
+// DiffReport 是当前结果与基线结果的对比报告
+type DiffReport struct {
+	Baseline string              `json:"baseline"`
+	Current  string              `json:"current"`
+	Added    []map[string]string `json:"added"`
+	Removed  []map[string]string `json:"removed"`
+	Changed  []ChangedLocation   `json:"changed"`
+}
+
+// DiffCSV 按 LocationID (不存在时按 Link) 对比基线结果和当前结果，
+// 找出新增、已从 ATMB 下架以及价格或 CMRA 状态发生变化的地点。
+func DiffCSV(baseline, current string) (*DiffReport, error) {
+	oldRows, err := readKeyedCSV(baseline)
+	if err != nil {
+		return nil, err
+	}
+	newRows, err := readKeyedCSV(current)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DiffReport{
+		Baseline: baseline,
+		Current:  current,
+		Added:    []map[string]string{},
+		Removed:  []map[string]string{},
+		Changed:  []ChangedLocation{},
+	}
+	for _, key := range newRows.keys {
+		row := newRows.rows[key]
+		old, ok := oldRows.rows[key]
+		if !ok {
+			report.Added = append(report.Added, row)
+			continue
+		}
+		changes := map[string]FieldChange{}
+		for _, field := range diffFields {
+			if old[field] != row[field] {
+				changes[field] = FieldChange{Old: old[field], New: row[field]}
+			}
+		}
+		if len(changes) > 0 {
+			report.Changed = append(report.Changed, ChangedLocation{Key: key, Row: row, Changes: changes})
+		}
+	}
+	for _, key := range oldRows.keys {
+		if _, ok := newRows.rows[key]; !ok {
+			report.Removed = append(report.Removed, oldRows.rows[key])
+		}
+	}
+	return report, nil
+}
+
+// WriteDiffReport 将对比报告以 JSON 格式写入文件
+func WriteDiffReport(filename string, report *DiffReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("格式化对比报告失败: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("写入对比报告失败: %w", err)
+	}
+	return nil
+}
+
+// keyedRows 是按键索引的 CSV 行，keys 保留文件中的出现顺序
+type keyedRows struct {
+	keys []string
+	rows map[string]map[string]string
+}
+
+// readKeyedCSV 读取结果 CSV，将每行转换为 列名->值 的映射并按键索引。
+// 没有键的行无法对比，会被忽略；重复的键只保留第一次出现的行。
+func readKeyedCSV(filename string) (*keyedRows, error) {
+	records, err := readCSVFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	keyed := &keyedRows{rows: map[string]map[string]string{}}
+	if len(records) == 0 {
+		return keyed, nil
+	}
+
+	header := records[0]
+	keyIndex := keyColumnIndex(header)
+	if keyIndex < 0 {
+		return nil, fmt.Errorf("%s 中没有可用于对比的列 (%s)", filename, strings.Join(dedupeKeyColumns, " 或 "))
+	}
+	for _, record := range records[1:] {
+		if keyIndex >= len(record) {
+			continue
+		}
+		key := strings.TrimSpace(record[keyIndex])
+		if key == "" || keyed.rows[key] != nil {
+			continue
+		}
+		row := make(map[string]string, len(header))
+		for i, name := range header {
+			if i < len(record) {
+				row[strings.TrimSpace(name)] = record[i]
+			}
+		}
+		keyed.keys = append(keyed.keys, key)
+		keyed.rows[key] = row
+	}
+	return keyed, nil
+}
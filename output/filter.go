@@ -0,0 +1,64 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"atmb/model"
+)
+
+// CMRA 状态未知 (Smarty 没有返回 Y/N) 时的处理方式
+const (
+	UnknownCMRAKeep = "keep" // 保留，交给人工核对
+	UnknownCMRADrop = "drop" // 视为可能是 CMRA，丢弃
+)
+
+// ValidateUnknownCMRA 检查未知 CMRA 状态的处理方式是否受支持
+func ValidateUnknownCMRA(mode string) error {
+	switch mode {
+	case UnknownCMRAKeep, UnknownCMRADrop:
+		return nil
+	}
+	return fmt.Errorf("不支持的处理方式: %s (可选 %s, %s)", mode, UnknownCMRAKeep, UnknownCMRADrop)
+}
+
+// NonCMRAFilter 在写入结果之前丢弃 CMRA 地址 (DPVCMRACode 为 Y)，只保留非 CMRA 地址。
+// CMRA 为 N 的地址总是保留；为空或其他值 (如 UNKNOWN) 的地址按 Unknown 处理。
+type NonCMRAFilter struct {
+	Unknown string
+
+	dropped atomic.Int64
+}
+
+// Keep 判断地址是否应该写入结果
+func (f *NonCMRAFilter) Keep(addr *model.Address) bool {
+	switch strings.ToUpper(strings.TrimSpace(addr.CMRA)) {
+	case "Y":
+		return false
+	case "N":
+		return true
+	}
+	return f.Unknown != UnknownCMRADrop
+}
+
+// Filter 返回只包含应保留地址的通道，results 关闭后该通道随之关闭
+func (f *NonCMRAFilter) Filter(results <-chan *model.Address) <-chan *model.Address {
+	kept := make(chan *model.Address, cap(results))
+	go func() {
+		defer close(kept)
+		for addr := range results {
+			if f.Keep(addr) {
+				kept <- addr
+			} else {
+				f.dropped.Add(1)
+			}
+		}
+	}()
+	return kept
+}
+
+// Dropped 返回已丢弃的地址数量
+func (f *NonCMRAFilter) Dropped() int64 {
+	return f.dropped.Load()
+}
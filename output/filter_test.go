@@ -0,0 +1,48 @@
+package output
+
+import (
+	"slices"
+	"testing"
+
+	"atmb/model"
+)
+
+func TestNonCMRAFilter(t *testing.T) {
+	cmras := []string{"Y", "N", "UNKNOWN", "", " y ", "n"}
+	tests := []struct {
+		unknown     string
+		wantKept    []string
+		wantDropped int64
+	}{
+		{unknown: UnknownCMRAKeep, wantKept: []string{"N", "UNKNOWN", "", "n"}, wantDropped: 2},
+		{unknown: UnknownCMRADrop, wantKept: []string{"N", "n"}, wantDropped: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unknown, func(t *testing.T) {
+			addrs := make([]*model.Address, len(cmras))
+			for i, cmra := range cmras {
+				addrs[i] = &model.Address{CMRA: cmra}
+			}
+			filter := &NonCMRAFilter{Unknown: tt.unknown}
+
+			var kept []string
+			for addr := range filter.Filter(sendAll(addrs)) {
+				kept = append(kept, addr.CMRA)
+			}
+			if !slices.Equal(kept, tt.wantKept) {
+				t.Errorf("保留了 %q，want %q", kept, tt.wantKept)
+			}
+			if got := filter.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.wantDropped)
+			}
+		})
+	}
+}
+
+func TestValidateUnknownCMRA(t *testing.T) {
+	for mode, wantErr := range map[string]bool{UnknownCMRAKeep: false, UnknownCMRADrop: false, "": true, "skip": true} {
+		if err := ValidateUnknownCMRA(mode); (err != nil) != wantErr {
+			t.Errorf("ValidateUnknownCMRA(%q) error = %v, wantErr %v", mode, err, wantErr)
+		}
+	}
+}
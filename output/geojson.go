@@ -0,0 +1,78 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"atmb/model"
+)
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Geometry   geoJSONPoint      `json:"geometry"`
+	Properties map[string]string `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"` // GeoJSON 规定顺序为 [经度, 纬度]
+}
+
+// WriteToGeoJSON 将成功处理的地址写入 GeoJSON 文件，每个地址对应一个 Point 要素。
+// 没有经纬度的地址会被跳过并记录警告。写入失败时与 WriteToCSV 一样尝试备用文件。
+func WriteToGeoJSON(filename string, results <-chan *model.Address) error {
+	addresses := collect(results)
+
+	collection := geoJSONFeatureCollection{Type: "FeatureCollection", Features: []geoJSONFeature{}}
+	skipped := 0
+	for _, addr := range addresses {
+		if !addr.HasCoordinates() {
+			log.Printf("警告: 地址缺少经纬度，不写入 GeoJSON: %s, %s", addr.Street, addr.City)
+			skipped++
+			continue
+		}
+		collection.Features = append(collection.Features, geoJSONFeature{
+			Type: "Feature",
+			Geometry: geoJSONPoint{
+				Type:        "Point",
+				Coordinates: [2]float64{addr.Longitude, addr.Latitude},
+			},
+			Properties: map[string]string{
+				"title":  addr.Title,
+				"price":  addr.Price,
+				"street": addr.Street,
+				"city":   addr.City,
+				"state":  addr.State,
+				"zip":    addr.Zip,
+				"link":   addr.Link,
+				"cmra":   addr.CMRA,
+				"rdi":    addr.RDI,
+				"status": addr.Status,
+			},
+		})
+	}
+
+	if len(collection.Features) == 0 {
+		log.Printf("没有需要写入GeoJSON的结果 (跳过 %d 个缺少坐标的地址)。", skipped)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(collection, "", "  ")
+	if err != nil {
+		return fmt.Errorf("格式化GeoJSON失败: %w", err)
+	}
+
+	log.Printf("准备将 %d 个地址写入GeoJSON文件 (跳过 %d 个缺少坐标的地址)...", len(collection.Features), skipped)
+	write := func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}
+	return writeWithFallback(filename, write, write)
+}
@@ -0,0 +1,205 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"atmb/model"
+)
+
+// jsonlRecord 是 JSON Lines 文件中的一行，字段名使用 snake_case，方便 Elasticsearch 等工具直接导入。
+// 无法确定的值 (价格未知、CMRA 未验证、缺少坐标) 写为 null，未开启相应功能的可选字段省略。
+type jsonlRecord struct {
+	Title                 string   `json:"title"`
+	Price                 *float64 `json:"price"`
+	Street                string   `json:"street"`
+	Secondary             string   `json:"secondary,omitempty"`
+	City                  string   `json:"city"`
+	State                 string   `json:"state"`
+	Zip                   string   `json:"zip"`
+	Link                  string   `json:"link"`
+	CMRA                  *bool    `json:"cmra"`
+	RDI                   string   `json:"rdi"`
+	Status                string   `json:"status"`
+	Latitude              *float64 `json:"latitude"`
+	Longitude             *float64 `json:"longitude"`
+	LocationName          string   `json:"location_name,omitempty"`
+	Descriptor            string   `json:"descriptor,omitempty"`
+	MatchTier             string   `json:"match_tier,omitempty"`
+	County                string   `json:"county,omitempty"`
+	Vacant                string   `json:"vacant,omitempty"`
+	RecordType            string   `json:"record_type,omitempty"`
+	CongressionalDistrict string   `json:"congressional_district,omitempty"`
+	Candidates            int      `json:"candidates,omitempty"`
+	LowConfidence         bool     `json:"low_confidence,omitempty"`
+}
+
+// newJSONLRecord 将地址转换为 JSON Lines 的一行
+func newJSONLRecord(addr *model.Address) jsonlRecord {
+	rec := jsonlRecord{
+		Title:                 addr.Title,
+		Street:                addr.Street,
+		Secondary:             addr.Secondary,
+		City:                  addr.City,
+		State:                 addr.State,
+		Zip:                   addr.Zip,
+		Link:                  addr.Link,
+		RDI:                   addr.RDI,
+		Status:                addr.Status,
+		LocationName:          addr.LocationName,
+		Descriptor:            addr.Descriptor,
+		MatchTier:             addr.MatchTier,
+		County:                addr.County,
+		Vacant:                addr.Vacant,
+		RecordType:            addr.RecordType,
+		CongressionalDistrict: addr.CongressionalDistrict,
+		Candidates:            addr.Candidates,
+		LowConfidence:         addr.LowConfidence,
+	}
+	if addr.PriceCents >= 0 {
+		price := float64(addr.PriceCents) / 100
+		rec.Price = &price
+	}
+	switch addr.CMRA {
+	case "Y":
+		cmra := true
+		rec.CMRA = &cmra
+	case "N":
+		cmra := false
+		rec.CMRA = &cmra
+	}
+	if addr.HasCoordinates() {
+		lat, lng := addr.Latitude, addr.Longitude
+		rec.Latitude, rec.Longitude = &lat, &lng
+	}
+	return rec
+}
+
+// JSONLWriter 将结果以 JSON Lines (每行一个 JSON 对象) 流式写入文件
+type JSONLWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w JSONLWriter) Write(results <-chan *model.Address) error {
+	return WriteToJSONL(w.Filename, results)
+}
+
+// WriteToJSONL 在结果到达时逐行写入 JSON Lines 文件，容错方式与 WriteToCSV 的流式写入相同：
+// 主文件无法创建或中途写入失败时，尚未确认落盘的行和之后的结果改为写入带时间戳的备用文件；
+// 备用文件也失败时，剩余结果在通道关闭后以 JSON Lines 格式打印到控制台，并返回错误。
+func WriteToJSONL(filename string, results <-chan *model.Address) error {
+	first, ok := <-results
+	if !ok {
+		log.Println("没有需要写入JSONL的结果。")
+		return nil
+	}
+
+	// pending 是尚未确认写入任何文件的结果
+	pending := []*model.Address{first}
+	var lastErr error
+	for i, name := range []string{filename, fallbackFilename(filename)} {
+		if i > 0 {
+			log.Printf("警告: 写入主文件 '%s' 失败 (%v)。正在尝试将剩余结果写入备用文件 %s...", filename, lastErr, name)
+		}
+		stream, err := openJSONLStream(name)
+		if err == nil {
+			if pending, err = stream.stream(pending, results); err == nil {
+				log.Printf("%d 条结果已成功写入 %s 文件。", stream.rows, name)
+				return nil
+			}
+		}
+		lastErr = err
+	}
+	log.Printf("错误: 写入备用文件时也失败了: %v", lastErr)
+
+	for addr := range results {
+		pending = append(pending, addr)
+	}
+	log.Println("!!严重警告!! 文件写入彻底失败。为防止数据丢失，将把剩余结果打印到控制台。")
+	log.Println("--- 数据开始 ---")
+	encoder := json.NewEncoder(os.Stdout)
+	for _, addr := range pending {
+		if err := encoder.Encode(newJSONLRecord(addr)); err != nil {
+			log.Printf("打印结果失败: %v", err)
+			break
+		}
+	}
+	log.Println("--- 数据结束 ---")
+	return fmt.Errorf("写入 %s 和备用文件均失败: %w", filename, lastErr)
+}
+
+// jsonlStream 是一个正在流式写入的 JSON Lines 文件，与 csvStream 一样记录尚未确认落盘的行
+type jsonlStream struct {
+	file      *os.File
+	buf       *bufio.Writer
+	encoder   *json.Encoder
+	unflushed []*model.Address
+	rows      int // 已确认落盘的行数
+}
+
+// openJSONLStream 创建 (覆盖) JSON Lines 文件
+func openJSONLStream(filename string) (*jsonlStream, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &jsonlStream{file: file, buf: buf, encoder: json.NewEncoder(buf)}, nil
+}
+
+// stream 先写入 pending，再写入 results 中陆续到达的结果，直到通道关闭后关闭文件。
+// 写入失败时关闭文件并返回尚未确认落盘的结果，通道中剩余的结果留给调用方继续处理。
+func (s *jsonlStream) stream(pending []*model.Address, results <-chan *model.Address) ([]*model.Address, error) {
+	for i, addr := range pending {
+		if err := s.write(addr); err != nil {
+			return s.abort(pending[i+1:]), err
+		}
+	}
+	for addr := range results {
+		if err := s.write(addr); err != nil {
+			return s.abort(nil), err
+		}
+	}
+	err := s.flush()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return s.unflushed, err
+	}
+	return nil, nil
+}
+
+// write 写入一行，每 flushEvery 行刷新一次文件
+func (s *jsonlStream) write(addr *model.Address) error {
+	s.unflushed = append(s.unflushed, addr)
+	if err := s.encoder.Encode(newJSONLRecord(addr)); err != nil {
+		return err
+	}
+	if len(s.unflushed) >= flushEvery {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush 将缓冲的行写入文件，成功后这些行视为已落盘
+func (s *jsonlStream) flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	s.rows += len(s.unflushed)
+	s.unflushed = s.unflushed[:0]
+	return nil
+}
+
+// abort 在写入失败后关闭文件，返回尚未确认落盘的行以及 rest
+func (s *jsonlStream) abort(rest []*model.Address) []*model.Address {
+	if err := s.file.Close(); err != nil {
+		log.Println("关闭JSONL文件失败: ", err)
+	}
+	return append(s.unflushed, rest...)
+}
@@ -0,0 +1,186 @@
+package output
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"atmb/model"
+)
+
+// WriteBoundedCSV 与 WriteToCSV 相同，但内存中最多缓冲 maxRows 条结果。
+// 缓冲区满时按 SortOrder 排序后溢出到临时文件，结束时再将所有临时文件归并写入 filename，
+// 因此即使开启排序，内存占用也只与 maxRows 有关，而与结果总数无关。
+func WriteBoundedCSV(filename string, results <-chan *model.Address, maxRows int) error {
+	tmpDir, err := os.MkdirTemp("", "atmb-results-*")
+	if err != nil {
+		log.Printf("警告: 无法创建溢出目录 (%v)，改为全部在内存中缓冲。", err)
+		return WriteToCSV(filename, results)
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Println("WriteBoundedCSV 清理溢出目录错误: ", err)
+		}
+	}()
+
+	var runs []string
+	buffer := make([]*model.Address, 0, maxRows)
+	total := 0
+	spillFailed := false
+	for addr := range results {
+		buffer = append(buffer, addr)
+		total++
+		if len(buffer) < maxRows || spillFailed {
+			continue
+		}
+		run, err := spillRun(tmpDir, len(runs), buffer)
+		if err != nil {
+			// 磁盘不可用时只能把剩余结果全部缓冲在内存中，结束时与已溢出的文件一起归并
+			log.Printf("警告: 溢出结果到磁盘失败，剩余结果将全部在内存中缓冲: %v", err)
+			spillFailed = true
+			continue
+		}
+		runs = append(runs, run)
+		buffer = buffer[:0]
+	}
+
+	if total == 0 {
+		log.Println("没有需要写入CSV的结果。")
+		return nil
+	}
+	// 没有发生溢出时与 WriteToCSV 完全相同
+	if len(runs) == 0 {
+		sortAddresses(buffer)
+		return writeAddresses(filename, buffer)
+	}
+	if len(buffer) > 0 && !spillFailed {
+		run, err := spillRun(tmpDir, len(runs), buffer)
+		if err != nil {
+			log.Printf("警告: 溢出剩余结果到磁盘失败: %v", err)
+		} else {
+			runs = append(runs, run)
+			buffer = nil
+		}
+	}
+	log.Printf("所有地址处理完毕。准备将 %d 条结果 (%d 个溢出文件) 归并写入CSV文件...", total, len(runs))
+
+	writeMerged := func(w io.Writer) error { return mergeRuns(w, runs, buffer) }
+	return writeWithFallback(filename, writeMerged, writeMerged)
+}
+
+// spillRun 将缓冲区排序后写入一个临时文件。每行的第一列是用于归并排序的 PriceCents，其余为输出列。
+func spillRun(dir string, index int, buffer []*model.Address) (string, error) {
+	sortAddresses(buffer)
+	name := filepath.Join(dir, fmt.Sprintf("run_%d.csv", index))
+	file, err := os.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("创建溢出文件失败: %w", err)
+	}
+	writer := csv.NewWriter(file)
+	for _, addr := range buffer {
+		_ = writer.Write(append([]string{strconv.Itoa(addr.PriceCents)}, record(addr)...))
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("写入溢出文件失败: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("关闭溢出文件失败: %w", err)
+	}
+	return name, nil
+}
+
+// runHead 是归并时某个溢出文件 (或内存中剩余结果) 的当前行
+type runHead struct {
+	price  int
+	record []string
+	next   func() (int, []string, bool, error)
+}
+
+// mergeRuns 将各个已排序的溢出文件以及内存中剩余的 rest 归并写入 w。
+// 未开启排序时按溢出顺序依次输出，即保持结果到达的顺序；价格相同时先输出较早的溢出文件。
+func mergeRuns(w io.Writer, runs []string, rest []*model.Address) error {
+	var heads []*runHead
+	for _, name := range runs {
+		file, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("打开溢出文件失败: %w", err)
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				log.Println("mergeRuns 文件退出错误: ", err)
+			}
+		}()
+		reader := csv.NewReader(file)
+		heads = append(heads, &runHead{next: func() (int, []string, bool, error) {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return 0, nil, false, nil
+			}
+			if err != nil {
+				return 0, nil, false, fmt.Errorf("读取溢出文件失败: %w", err)
+			}
+			price, _ := strconv.Atoi(row[0])
+			return price, row[1:], true, nil
+		}})
+	}
+	sortAddresses(rest)
+	i := 0
+	heads = append(heads, &runHead{next: func() (int, []string, bool, error) {
+		if i >= len(rest) {
+			return 0, nil, false, nil
+		}
+		addr := rest[i]
+		i++
+		return addr.PriceCents, record(addr), true, nil
+	}})
+
+	// 读取每个来源的第一行，已读完的来源从列表中移除
+	advance := func(h *runHead) (bool, error) {
+		price, row, ok, err := h.next()
+		h.price, h.record = price, row
+		return ok, err
+	}
+	active := heads[:0]
+	for _, h := range heads {
+		ok, err := advance(h)
+		if err != nil {
+			return err
+		}
+		if ok {
+			active = append(active, h)
+		}
+	}
+
+	writer := newCSVWriter(w)
+	if err := writer.Write(header()); err != nil {
+		return fmt.Errorf("写入CSV表头失败: %w", err)
+	}
+	for len(active) > 0 {
+		best := 0
+		if SortOrder == SortPrice {
+			for j := 1; j < len(active); j++ {
+				if priceLess(active[j].price, active[best].price) {
+					best = j
+				}
+			}
+		}
+		if err := writer.Write(active[best].record); err != nil {
+			return fmt.Errorf("写入CSV行失败: %w", err)
+		}
+		ok, err := advance(active[best])
+		if err != nil {
+			return err
+		}
+		if !ok {
+			active = append(active[:best], active[best+1:]...)
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,103 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"atmb/model"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRow 是写入 Parquet 文件的一行，使用带类型的列方便分析工具直接查询。
+// 无法确定的值 (价格未知、CMRA 未验证、缺少坐标) 写为 null。
+type parquetRow struct {
+	Title        string   `parquet:"title"`
+	Price        *float64 `parquet:"price,optional"`
+	Street       string   `parquet:"street"`
+	City         string   `parquet:"city"`
+	State        string   `parquet:"state"`
+	Zip          string   `parquet:"zip"`
+	Link         string   `parquet:"link"`
+	CMRA         *bool    `parquet:"cmra,optional"`
+	RDI          string   `parquet:"rdi"`
+	Latitude     *float64 `parquet:"latitude,optional"`
+	Longitude    *float64 `parquet:"longitude,optional"`
+	LocationName string   `parquet:"location_name"`
+	Descriptor   string   `parquet:"descriptor"`
+	MatchTier    string   `parquet:"match_tier"`
+	Available    bool     `parquet:"available"`
+	Status       string   `parquet:"status"`
+}
+
+// newParquetRow 将地址转换为 Parquet 行
+func newParquetRow(addr *model.Address) parquetRow {
+	row := parquetRow{
+		Title:        addr.Title,
+		Street:       addr.Street,
+		City:         addr.City,
+		State:        addr.State,
+		Zip:          addr.Zip,
+		Link:         addr.Link,
+		RDI:          addr.RDI,
+		LocationName: addr.LocationName,
+		Descriptor:   addr.Descriptor,
+		MatchTier:    addr.MatchTier,
+		Available:    addr.Available(),
+		Status:       addr.Status,
+	}
+	if addr.PriceCents >= 0 {
+		price := float64(addr.PriceCents) / 100
+		row.Price = &price
+	}
+	switch addr.CMRA {
+	case "Y":
+		cmra := true
+		row.CMRA = &cmra
+	case "N":
+		cmra := false
+		row.CMRA = &cmra
+	}
+	if addr.HasCoordinates() {
+		lat, lng := addr.Latitude, addr.Longitude
+		row.Latitude, row.Longitude = &lat, &lng
+	}
+	return row
+}
+
+// WriteToParquet 将成功处理的地址写入 Parquet 文件。
+// 写入失败时与 WriteToCSV 一样尝试带时间戳的备用文件；Parquet 是二进制格式，
+// 备用文件也失败时改为以 CSV 格式把结果打印到控制台。
+func WriteToParquet(filename string, results <-chan *model.Address) error {
+	addresses := collect(results)
+	if len(addresses) == 0 {
+		log.Println("没有需要写入Parquet的结果。")
+		return nil
+	}
+
+	rows := make([]parquetRow, len(addresses))
+	for i, addr := range addresses {
+		rows[i] = newParquetRow(addr)
+	}
+
+	log.Printf("准备将 %d 条结果写入Parquet文件...", len(rows))
+	write := func(w io.Writer) error { return writeParquet(w, rows) }
+	dump := func(w io.Writer) error {
+		_, err := writeRows(w, addresses)
+		return err
+	}
+	return writeWithFallback(filename, write, dump)
+}
+
+// writeParquet 将所有行以 Parquet 格式写入 w
+func writeParquet(w io.Writer, rows []parquetRow) error {
+	writer := parquet.NewGenericWriter[parquetRow](w)
+	if _, err := writer.Write(rows); err != nil {
+		return fmt.Errorf("写入Parquet数据失败: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("写入Parquet文件尾失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+
+	"atmb/model"
+)
+
+// 支持的排序方式
+const (
+	SortNone  = ""
+	SortPrice = "price"
+)
+
+// SortOrder 是缓冲写入 (WriteToCSV、WriteToGeoJSON) 时对结果的排序方式
+var SortOrder = SortNone
+
+// ValidateSortOrder 检查排序方式是否受支持
+func ValidateSortOrder(order string) error {
+	switch order {
+	case SortNone, SortPrice:
+		return nil
+	}
+	return fmt.Errorf("不支持的排序方式: %s (可选 %s)", order, SortPrice)
+}
+
+// sortAddresses 按 SortOrder 对地址原地排序，相同键保持原有顺序
+func sortAddresses(addresses []*model.Address) {
+	switch SortOrder {
+	case SortPrice:
+		// 按月租价格升序，价格未知的地址排在最后
+		sort.SliceStable(addresses, func(i, j int) bool {
+			return priceLess(addresses[i].PriceCents, addresses[j].PriceCents)
+		})
+	}
+}
+
+// priceLess 按月租价格升序比较两个以美分表示的价格，价格未知 (负数) 的排在最后
+func priceLess(pi, pj int) bool {
+	if pi < 0 || pj < 0 {
+		return pi >= 0 && pj < 0
+	}
+	return pi < pj
+}
@@ -0,0 +1,99 @@
+package output
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"atmb/model"
+)
+
+// StateSplitCSVWriter 按地址的 State 字段将结果写入 Dir 目录下每个州一个的 CSV 文件，如 results/california.csv
+type StateSplitCSVWriter struct {
+	Dir string
+}
+
+// Write 实现 OutputWriter 接口
+func (w StateSplitCSVWriter) Write(results <-chan *model.Address) error {
+	return WriteByState(w.Dir, results)
+}
+
+// WriteByState 在 dir 目录下为每个州创建一个带表头的 CSV 文件，结果到达后立即写入对应的文件。
+// 所有文件由当前协程独占写入，不需要加锁。某个州的文件无法创建或写入失败时，
+// 该州尚未落盘的结果和之后的结果改为写入带时间戳的备用 CSV 文件，其他州不受影响。
+func WriteByState(dir string, results <-chan *model.Address) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("警告: 创建按州输出的目录 %s 失败 (%v)。正在将结果写入备用文件...", dir, err)
+		return WriteToCSV(fallbackFilename(".csv"), results)
+	}
+
+	// streams 中值为 nil 的州表示该州的文件已经失败
+	streams := make(map[string]*csvStream)
+	rows := make(map[string]int)
+	var failed []*model.Address
+	for addr := range results {
+		name := filepath.Join(dir, stateFileName(addr.State)+".csv")
+		s, ok := streams[name]
+		if !ok {
+			var err error
+			if s, err = openCSVStream(name, false); err != nil {
+				log.Printf("警告: 创建 %s 失败: %v", name, err)
+			}
+			streams[name] = s
+		}
+		if s == nil {
+			failed = append(failed, addr)
+			continue
+		}
+		if err := s.write(addr); err != nil {
+			log.Printf("警告: 写入 %s 失败: %v", name, err)
+			failed = append(failed, s.abort(nil)...)
+			streams[name] = nil
+			continue
+		}
+		rows[name]++
+	}
+
+	for name, s := range streams {
+		if s == nil {
+			continue
+		}
+		if unflushed, err := s.close(); err != nil {
+			log.Printf("警告: 写入 %s 失败: %v", name, err)
+			failed = append(failed, unflushed...)
+			rows[name] -= len(unflushed)
+		}
+	}
+	if len(streams) == 0 {
+		log.Println("没有需要写入CSV的结果。")
+		return nil
+	}
+
+	total := 0
+	for _, n := range rows {
+		total += n
+	}
+	log.Printf("%d 条结果已按州写入 %s 目录下的 %d 个文件。", total, dir, len(streams))
+	if len(failed) > 0 {
+		log.Printf("警告: %d 条结果未能写入对应州的文件，正在写入备用文件...", len(failed))
+		return writeAddresses(fallbackFilename(".csv"), failed)
+	}
+	return nil
+}
+
+// stateFileName 将州名转换为文件名：小写，字母和数字之外的字符替换为连字符，州名为空时使用 unknown
+func stateFileName(state string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, strings.TrimSpace(state))
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,138 @@
+package output
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"atmb/model"
+
+	_ "modernc.org/sqlite" // 注册 sqlite 驱动 (纯 Go 实现，无需 cgo)
+)
+
+// sqliteBatchSize 是每个事务插入的行数，分批提交可以减少磁盘同步的次数
+const sqliteBatchSize = 500
+
+// SQLiteWriter 将结果写入 SQLite 数据库的 addresses 表，便于后续用 SQL 分析
+type SQLiteWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w SQLiteWriter) Write(results <-chan *model.Address) error {
+	return WriteToSQLite(w.Filename, results)
+}
+
+// sqliteSchema 创建 addresses 表。每次运行都会重建该表，与其他格式覆盖结果文件的行为一致。
+const sqliteSchema = `
+DROP TABLE IF EXISTS addresses;
+CREATE TABLE addresses (
+	id          INTEGER PRIMARY KEY,
+	title       TEXT,
+	price       TEXT,
+	price_cents INTEGER, -- 以美分表示的月租价格，未知时为 NULL
+	street      TEXT,
+	city        TEXT,
+	state       TEXT,
+	zip         TEXT,
+	link        TEXT,
+	cmra        TEXT,
+	rdi         TEXT,
+	status      TEXT,
+	match_tier  TEXT,
+	latitude    REAL,
+	longitude   REAL
+);`
+
+const sqliteInsert = `INSERT INTO addresses
+	(title, price, price_cents, street, city, state, zip, link, cmra, rdi, status, match_tier, latitude, longitude)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// WriteToSQLite 将结果逐条插入 dbPath 中的 addresses 表，每 sqliteBatchSize 行提交一次事务。
+// 数据库无法打开或写入失败时，尚未提交的结果和剩余结果改为写入带时间戳的备用 CSV 文件。
+func WriteToSQLite(dbPath string, results <-chan *model.Address) error {
+	first, ok := <-results
+	if !ok {
+		log.Println("没有需要写入 SQLite 的结果。")
+		return nil
+	}
+
+	// pending 是尚未提交到数据库的结果
+	pending := []*model.Address{first}
+	rows, err := insertSQLite(dbPath, &pending, results)
+	if err == nil {
+		log.Printf("%d 条结果已成功写入 %s 数据库。", rows, dbPath)
+		return nil
+	}
+
+	log.Printf("警告: 写入 SQLite 数据库 '%s' 失败 (已提交 %d 行): %v。正在将剩余结果写入备用 CSV 文件...", dbPath, rows, err)
+	for addr := range results {
+		pending = append(pending, addr)
+	}
+	return writeAddresses(fallbackFilename(".csv"), pending)
+}
+
+// insertSQLite 打开数据库并插入 pending 和 results 中的所有结果，返回已提交的行数。
+// 返回错误时，pending 中保留尚未提交的结果，results 中剩余的结果留给调用方处理。
+func insertSQLite(dbPath string, pending *[]*model.Address, results <-chan *model.Address) (int, error) {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return 0, fmt.Errorf("创建 addresses 表失败: %w", err)
+	}
+
+	committed := 0
+	commit := func() error {
+		if err := insertBatch(db, *pending); err != nil {
+			return err
+		}
+		committed += len(*pending)
+		*pending = (*pending)[:0]
+		return nil
+	}
+	for addr := range results {
+		*pending = append(*pending, addr)
+		if len(*pending) >= sqliteBatchSize {
+			if err := commit(); err != nil {
+				return committed, err
+			}
+		}
+	}
+	if err := commit(); err != nil {
+		return committed, err
+	}
+	return committed, nil
+}
+
+// insertBatch 在一个事务中使用预编译的语句插入 batch
+func insertBatch(db *sql.DB, batch []*model.Address) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开始事务失败: %w", err)
+	}
+	defer tx.Rollback() // 提交成功后 Rollback 不会产生任何效果
+
+	stmt, err := tx.Prepare(sqliteInsert)
+	if err != nil {
+		return fmt.Errorf("准备插入语句失败: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, addr := range batch {
+		var priceCents sql.NullInt64
+		if addr.PriceCents >= 0 {
+			priceCents = sql.NullInt64{Int64: int64(addr.PriceCents), Valid: true}
+		}
+		if _, err := stmt.Exec(addr.Title, addr.Price, priceCents, addr.Street, addr.City, addr.State, addr.Zip,
+			addr.Link, addr.CMRA, addr.RDI, addr.Status, addr.MatchTier, addr.Latitude, addr.Longitude); err != nil {
+			return fmt.Errorf("插入 %s, %s 失败: %w", addr.Street, addr.City, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("提交事务失败: %w", err)
+	}
+	return nil
+}
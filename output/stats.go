@@ -0,0 +1,136 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"atmb/model"
+)
+
+// stateStats 是单个州的结果统计
+type stateStats struct {
+	total, cmra, nonCMRA, unknownCMRA int
+}
+
+// ResultStats 统计写入结果的地址：CMRA 与非 CMRA 的数量、RDI 分布以及各州的数量。
+// 统计直接来自 results 中的地址，不需要额外的查询；可以被多个协程同时调用。
+type ResultStats struct {
+	mu      sync.Mutex
+	total   stateStats
+	rdi     map[string]int
+	byState map[string]*stateStats
+}
+
+// NewResultStats 创建一个空的结果统计
+func NewResultStats() *ResultStats {
+	return &ResultStats{rdi: map[string]int{}, byState: map[string]*stateStats{}}
+}
+
+// Record 统计一个地址
+func (s *ResultStats) Record(addr *model.Address) {
+	rdi := strings.TrimSpace(addr.RDI)
+	if rdi == "" {
+		rdi = "UNKNOWN"
+	}
+	state := strings.TrimSpace(addr.State)
+	if state == "" {
+		state = "(未知)"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rdi[rdi]++
+	st, ok := s.byState[state]
+	if !ok {
+		st = &stateStats{}
+		s.byState[state] = st
+	}
+	for _, counts := range []*stateStats{&s.total, st} {
+		counts.total++
+		switch strings.ToUpper(strings.TrimSpace(addr.CMRA)) {
+		case "Y":
+			counts.cmra++
+		case "N":
+			counts.nonCMRA++
+		default:
+			counts.unknownCMRA++
+		}
+	}
+}
+
+// Tap 返回与 results 内容相同的通道，经过的每个地址都会被统计，results 关闭后该通道随之关闭
+func (s *ResultStats) Tap(results <-chan *model.Address) <-chan *model.Address {
+	out := make(chan *model.Address, cap(results))
+	go func() {
+		defer close(out)
+		for addr := range results {
+			s.Record(addr)
+			out <- addr
+		}
+	}()
+	return out
+}
+
+// ResultTotals 是所有结果的 CMRA 统计
+type ResultTotals struct {
+	Total       int `json:"total"`
+	CMRA        int `json:"cmra"`
+	NonCMRA     int `json:"non_cmra"`
+	UnknownCMRA int `json:"unknown_cmra"`
+}
+
+// Totals 返回目前为止所有结果的 CMRA 统计
+func (s *ResultStats) Totals() ResultTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ResultTotals{Total: s.total.total, CMRA: s.total.cmra, NonCMRA: s.total.nonCMRA, UnknownCMRA: s.total.unknownCMRA}
+}
+
+// LogSummary 以表格形式输出统计结果
+func (s *ResultStats) LogSummary() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.total.total == 0 {
+		log.Println("结果统计: 本次运行没有验证成功的地址。")
+		return
+	}
+
+	log.Printf("结果统计: 共 %d 个地址，CMRA %d 个，非 CMRA %d 个，CMRA 未知 %d 个。",
+		s.total.total, s.total.cmra, s.total.nonCMRA, s.total.unknownCMRA)
+
+	rdis := make([]string, 0, len(s.rdi))
+	for rdi := range s.rdi {
+		rdis = append(rdis, rdi)
+	}
+	sort.Strings(rdis)
+	parts := make([]string, len(rdis))
+	for i, rdi := range rdis {
+		parts[i] = fmt.Sprintf("%s %d 个", rdi, s.rdi[rdi])
+	}
+	log.Printf("RDI 分布: %s", strings.Join(parts, "，"))
+
+	states := make([]string, 0, len(s.byState))
+	for state := range s.byState {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "State\tTotal\tCMRA\tNon-CMRA\tUnknown\t")
+	for _, state := range states {
+		st := s.byState[state]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t\n", state, st.total, st.cmra, st.nonCMRA, st.unknownCMRA)
+	}
+	fmt.Fprintf(w, "Total\t%d\t%d\t%d\t%d\t\n", s.total.total, s.total.cmra, s.total.nonCMRA, s.total.unknownCMRA)
+	w.Flush()
+	log.Println("各州统计:")
+	for _, line := range strings.Split(strings.TrimRight(buf.String(), "\n"), "\n") {
+		log.Println(line)
+	}
+}
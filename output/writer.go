@@ -0,0 +1,169 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"atmb/model"
+)
+
+// OutputWriter 消费结果通道并将所有结果写入某种输出格式。
+// 实现应在通道关闭后返回；只有在结果无法写入任何文件 (已退回到打印控制台) 时才返回错误。
+type OutputWriter interface {
+	Write(results <-chan *model.Address) error
+}
+
+// CSVWriter 将结果缓冲后写入单个 CSV 文件
+type CSVWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w CSVWriter) Write(results <-chan *model.Address) error {
+	return WriteToCSV(w.Filename, results)
+}
+
+// ShardedCSVWriter 将结果并行写入 Shards 个分片文件，最后合并为 Filename
+type ShardedCSVWriter struct {
+	Filename string
+	Shards   int
+}
+
+// Write 实现 OutputWriter 接口
+func (w ShardedCSVWriter) Write(results <-chan *model.Address) error {
+	return WriteShardedCSV(w.Filename, results, w.Shards)
+}
+
+// BoundedCSVWriter 在内存中最多缓冲 MaxRows 条结果，超出部分溢出到临时文件
+type BoundedCSVWriter struct {
+	Filename string
+	MaxRows  int
+}
+
+// Write 实现 OutputWriter 接口
+func (w BoundedCSVWriter) Write(results <-chan *model.Address) error {
+	return WriteBoundedCSV(w.Filename, results, w.MaxRows)
+}
+
+// GeoJSONWriter 将带坐标的结果写入 GeoJSON 文件
+type GeoJSONWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w GeoJSONWriter) Write(results <-chan *model.Address) error {
+	return WriteToGeoJSON(w.Filename, results)
+}
+
+// ParquetWriter 将结果写入 Parquet 文件
+type ParquetWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w ParquetWriter) Write(results <-chan *model.Address) error {
+	return WriteToParquet(w.Filename, results)
+}
+
+// collect 读取通道中的所有结果并按 SortOrder 排序
+func collect(results <-chan *model.Address) []*model.Address {
+	var addresses []*model.Address
+	for addr := range results {
+		addresses = append(addresses, addr)
+	}
+	sortAddresses(addresses)
+	return addresses
+}
+
+// writeWithFallback 是所有写入器共用的容错流程：
+// 1. 尝试将 write 的输出写入主文件 filename。
+// 2. 如果失败，则写入一个与主文件同扩展名、带时间戳的备用文件。
+// 3. 如果再次失败，则调用 dump 将数据打印到控制台，以防丢失，并返回错误。
+// write 可能被调用两次，需要自行处理主文件写入一半时的状态。
+func writeWithFallback(filename string, write func(w io.Writer) error, dump func(w io.Writer) error) error {
+	return writeWithFallbackTo(filename, fallbackFilename(filename), write, dump)
+}
+
+// writeWithFallbackTo 与 writeWithFallback 相同，但使用指定的备用文件名
+func writeWithFallbackTo(filename, fallbackFilename string, write func(w io.Writer) error, dump func(w io.Writer) error) error {
+	err := writeFile(filename, write)
+	if err == nil {
+		log.Printf("结果已成功写入 %s 文件。", filename)
+		return nil
+	}
+	log.Printf("警告: 写入主文件 '%s' 失败 (%v)。正在尝试创建备用文件...", filename, err)
+
+	fallbackErr := writeFile(fallbackFilename, write)
+	if fallbackErr == nil {
+		log.Printf("结果已成功写入备用文件 %s。", fallbackFilename)
+		return nil
+	}
+	log.Printf("错误: 写入备用文件 %s 时也失败了: %v", fallbackFilename, fallbackErr)
+
+	log.Println("!!严重警告!! 文件写入彻底失败。为防止数据丢失，将把结果打印到控制台。")
+	log.Println("--- 数据开始 ---")
+	if err := dump(os.Stdout); err != nil {
+		log.Printf("打印结果失败: %v", err)
+	}
+	log.Println("--- 数据结束 ---")
+	return fmt.Errorf("写入 %s 和备用文件 %s 均失败: %w", filename, fallbackFilename, fallbackErr)
+}
+
+// fallbackFilename 返回与 filename 同扩展名、带时间戳的备用文件名
+func fallbackFilename(filename string) string {
+	return fmt.Sprintf("results_fallback_%s%s", time.Now().Format("20060102150405"), filepath.Ext(filename))
+}
+
+// writeFile 创建文件并调用 write 写入内容，关闭文件的错误同样视为写入失败
+func writeFile(filename string, write func(w io.Writer) error) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// MultiWriter 将每条结果同时写入多个输出，例如同时写入 CSV 和数据库，提供冗余。
+// 每个输出在独立的协程中运行，某个输出出错不会影响其他输出完成写入。
+type MultiWriter struct {
+	Writers []OutputWriter
+}
+
+// Write 实现 OutputWriter 接口，等待所有输出完成后返回它们的错误 (如有)
+func (m MultiWriter) Write(results <-chan *model.Address) error {
+	sinks := make([]chan *model.Address, len(m.Writers))
+	errs := make([]error, len(m.Writers))
+	var wg sync.WaitGroup
+	wg.Add(len(m.Writers))
+	for i, writer := range m.Writers {
+		sinks[i] = make(chan *model.Address, 100)
+		go func(i int, writer OutputWriter) {
+			defer wg.Done()
+			errs[i] = writer.Write(sinks[i])
+			// 输出提前返回时继续读取剩余结果，避免阻塞其他输出
+			for range sinks[i] {
+			}
+		}(i, writer)
+	}
+
+	for addr := range results {
+		for _, sink := range sinks {
+			sink <- addr
+		}
+	}
+	for _, sink := range sinks {
+		close(sink)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
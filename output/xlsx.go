@@ -0,0 +1,114 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+
+	"atmb/model"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// xlsxSheet 是结果所在的工作表名称
+const xlsxSheet = "Results"
+
+// xlsxTextFormat 是 Excel 内置的文本数字格式 (@)，邮编按文本保存，不会丢失开头的 0
+const xlsxTextFormat = 49
+
+// XLSXWriter 将结果写入 Excel 工作簿，列与 CSV 结果相同
+type XLSXWriter struct {
+	Filename string
+}
+
+// Write 实现 OutputWriter 接口
+func (w XLSXWriter) Write(results <-chan *model.Address) error {
+	return WriteToXLSX(w.Filename, results)
+}
+
+// WriteToXLSX 与 WriteToCSV 一样缓冲所有结果，排序后写入 Excel 工作簿：表头加粗，Zip 列为文本格式。
+// 生成工作簿失败时改为写入带时间戳的备用 CSV 文件；工作簿写入文件失败时按 writeWithFallback 的流程处理。
+func WriteToXLSX(filename string, results <-chan *model.Address) error {
+	addresses := collect(results)
+	if len(addresses) == 0 {
+		log.Println("没有需要写入Excel的结果。")
+		return nil
+	}
+
+	log.Printf("准备将 %d 条结果写入Excel文件...", len(addresses))
+	workbook, err := buildWorkbook(addresses)
+	if err != nil {
+		log.Printf("警告: 生成Excel工作簿失败: %v。正在将结果写入备用 CSV 文件...", err)
+		return writeAddresses(fallbackFilename(".csv"), addresses)
+	}
+
+	write := func(w io.Writer) error {
+		_, err := w.Write(workbook)
+		return err
+	}
+	dump := func(w io.Writer) error {
+		_, err := writeRows(w, addresses)
+		return err
+	}
+	return writeWithFallback(filename, write, dump)
+}
+
+// buildWorkbook 生成包含所有结果的工作簿，返回 .xlsx 文件的内容
+func buildWorkbook(addresses []*model.Address) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+	if err := f.SetSheetName(f.GetSheetName(0), xlsxSheet); err != nil {
+		return nil, fmt.Errorf("重命名工作表失败: %w", err)
+	}
+
+	boldStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return nil, fmt.Errorf("创建表头样式失败: %w", err)
+	}
+	textStyle, err := f.NewStyle(&excelize.Style{NumFmt: xlsxTextFormat})
+	if err != nil {
+		return nil, fmt.Errorf("创建文本样式失败: %w", err)
+	}
+
+	sw, err := f.NewStreamWriter(xlsxSheet)
+	if err != nil {
+		return nil, fmt.Errorf("创建工作表写入器失败: %w", err)
+	}
+	names := header()
+	cells := make([]any, len(names))
+	for i, name := range names {
+		cells[i] = excelize.Cell{StyleID: boldStyle, Value: name}
+	}
+	if err := sw.SetRow("A1", cells); err != nil {
+		return nil, fmt.Errorf("写入表头失败: %w", err)
+	}
+
+	for i, addr := range addresses {
+		values := record(addr)
+		cells := make([]any, len(values))
+		for j, value := range values {
+			cell := excelize.Cell{Value: value}
+			if names[j] == "Zip" {
+				cell.StyleID = textStyle
+			}
+			cells[j] = cell
+		}
+		axis, err := excelize.CoordinatesToCellName(1, i+2)
+		if err != nil {
+			return nil, err
+		}
+		if err := sw.SetRow(axis, cells); err != nil {
+			return nil, fmt.Errorf("写入第 %d 行失败: %w", i+1, err)
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return nil, fmt.Errorf("写入工作表失败: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("生成工作簿失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
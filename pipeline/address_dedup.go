@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"strings"
+	"sync"
+
+	"atmb/model"
+)
+
+// addressDeduper 记录已经推送到 jobs 的地址，同一地点出现在多个州页面或被重复列出时只验证一次，
+// 避免浪费 Smarty 查询次数。多个抓取工作单元共用同一个实例。
+type addressDeduper struct {
+	mu      sync.Mutex
+	seen    map[string]bool
+	skipped int
+}
+
+// addressKey 返回用于去重的规范化键：街道 (含二级地址)、城市、州和邮编转为大写并合并连续空白。
+// 同一栋楼里不同 Suite 的地点不会被当作重复。
+func addressKey(addr *model.Address) string {
+	fields := []string{addr.Street + " " + addr.Secondary, addr.City, addr.State, addr.Zip}
+	for i, field := range fields {
+		fields[i] = strings.Join(strings.Fields(strings.ToUpper(field)), " ")
+	}
+	return strings.Join(fields, "|")
+}
+
+// FirstSeen 在地址第一次出现时返回 true，重复的地址返回 false 并计入跳过的数量
+func (d *addressDeduper) FirstSeen(addr *model.Address) bool {
+	key := addressKey(addr)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[key] {
+		d.skipped++
+		return false
+	}
+	d.seen[key] = true
+	return true
+}
+
+// Skipped 返回因重复而跳过的地址数量
+func (d *addressDeduper) Skipped() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.skipped
+}
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// budgetReportInterval 是没有设置 ProgressInterval 时输出查询预算使用情况的间隔
+const budgetReportInterval = 30 * time.Second
+
+// lookupBudget 限制整个运行过程中 Smarty 查询的总次数，可被多个工作单元并发使用。
+// limit 为 0 表示不限制。
+type lookupBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+func newLookupBudget(limit int64) *lookupBudget {
+	return &lookupBudget{limit: limit}
+}
+
+// Take 尝试占用一次查询额度，额度已用完时返回 false
+func (b *lookupBudget) Take() bool {
+	return b.TakeN(1)
+}
+
+// TakeN 尝试一次占用 n 次查询额度，剩余额度不足 n 次时不占用并返回 false
+func (b *lookupBudget) TakeN(n int64) bool {
+	if b.limit <= 0 {
+		b.used.Add(n)
+		return true
+	}
+	if b.used.Add(n) > b.limit {
+		b.used.Add(-n)
+		return false
+	}
+	return true
+}
+
+// Release 归还占用了但没有实际发送的 n 次查询额度
+func (b *lookupBudget) Release(n int64) {
+	if n > 0 {
+		b.used.Add(-n)
+	}
+}
+
+// Used 返回已经占用的查询次数
+func (b *lookupBudget) Used() int64 {
+	return b.used.Load()
+}
+
+// Remaining 返回剩余的查询次数，limit 为 0 (不限制) 时返回 -1
+func (b *lookupBudget) Remaining() int64 {
+	if b.limit <= 0 {
+		return -1
+	}
+	return max(b.limit-b.used.Load(), 0)
+}
+
+// Report 每隔 interval 输出一次查询预算的使用情况，直到 stop 被关闭
+func (b *lookupBudget) Report(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			log.Printf("[预算] 已使用 %d/%d 次 Smarty 查询，剩余 %d 次", b.Used(), b.limit, b.Remaining())
+		}
+	}
+}
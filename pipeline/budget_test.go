@@ -0,0 +1,32 @@
+package pipeline
+
+import "testing"
+
+func TestLookupBudgetTakeNRelease(t *testing.T) {
+	b := newLookupBudget(5)
+	// -match-chain strict,enhanced 时每个地址预先占用 2 次
+	if !b.TakeN(2) || !b.TakeN(2) {
+		t.Fatal("TakeN(2) 在额度充足时失败")
+	}
+	if b.TakeN(2) {
+		t.Fatal("剩余 1 次时 TakeN(2) 应该失败")
+	}
+	if got := b.Used(); got != 4 {
+		t.Fatalf("失败的 TakeN 不应占用额度: Used() = %d, want 4", got)
+	}
+
+	// 第一个地址在 strict 下找到，enhanced 没有发送，归还 1 次
+	b.Release(1)
+	b.Release(0)
+	if got := b.Remaining(); got != 2 {
+		t.Errorf("Remaining() = %d, want 2", got)
+	}
+	if !b.TakeN(2) || b.Take() {
+		t.Errorf("归还后应该正好还能占用 2 次: Used() = %d", b.Used())
+	}
+
+	unlimited := newLookupBudget(0)
+	if !unlimited.TakeN(100) || unlimited.Used() != 100 || unlimited.Remaining() != -1 {
+		t.Errorf("不限制时 TakeN 应总是成功并计数: Used() = %d", unlimited.Used())
+	}
+}
@@ -0,0 +1,118 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"atmb/model"
+)
+
+// checkpointEntry 是检查点文件中的一行，记录一个已成功验证的地址及其验证结果
+type checkpointEntry struct {
+	Key string `json:"key"`
+	cachedVerification
+}
+
+// Checkpoint 记录本次运行中已经成功验证的地址。程序中途退出 (凭证耗尽、崩溃) 后重新运行时，
+// 这些地址直接复用已保存的验证结果，不再调用 Smarty。
+// 每验证成功一个地址就向文件追加一行 JSON，崩溃时最多丢失正在写入的一行。
+type Checkpoint struct {
+	mu        sync.Mutex
+	processed map[string]cachedVerification
+	file      *os.File
+}
+
+// checkpointKey 返回地址在检查点中的键：优先使用 Link，没有链接 (如输入文件模式) 时使用街道 (含二级地址) 和邮编
+func checkpointKey(addr *model.Address) string {
+	if addr.Link != "" {
+		return addr.Link
+	}
+	if addr.Secondary != "" {
+		return addr.Street + " " + addr.Secondary + "|" + addr.Zip
+	}
+	return addr.Street + "|" + addr.Zip
+}
+
+// OpenCheckpoint 读取已有的检查点文件 (不存在时视为空)，并打开文件以追加新的记录。
+// 最后一行可能因为崩溃而不完整，无法解析的行会被跳过并记录警告。
+func OpenCheckpoint(filename string) (*Checkpoint, error) {
+	c := &Checkpoint{processed: make(map[string]cachedVerification)}
+
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("读取检查点失败: %w", err)
+	}
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry checkpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Key == "" {
+			log.Printf("警告: 检查点 %s 第 %d 行无法解析，已跳过。", filename, i+1)
+			continue
+		}
+		c.processed[entry.Key] = entry.cachedVerification
+	}
+
+	if c.file, err = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return nil, fmt.Errorf("打开检查点失败: %w", err)
+	}
+	// 上次写入到一半的行没有换行符，先补上，避免新记录接在它后面
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		if _, err := c.file.Write([]byte("\n")); err != nil {
+			c.file.Close()
+			return nil, fmt.Errorf("写入检查点失败: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Len 返回检查点中已处理的地址数量
+func (c *Checkpoint) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.processed)
+}
+
+// Resume 在地址已经处理过时将保存的验证结果写回地址并返回 true
+func (c *Checkpoint) Resume(addr *model.Address) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.processed[checkpointKey(addr)]
+	if !ok {
+		return false
+	}
+	cached.apply(addr)
+	return true
+}
+
+// Record 将成功验证的地址追加到检查点文件，已经记录过的地址不会重复写入
+func (c *Checkpoint) Record(addr *model.Address) error {
+	key := checkpointKey(addr)
+	entry := checkpointEntry{Key: key, cachedVerification: newCachedVerification(addr)}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("格式化检查点记录失败: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.processed[key]; ok {
+		return nil
+	}
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("写入检查点失败: %w", err)
+	}
+	c.processed[key] = entry.cachedVerification
+	return nil
+}
+
+// Close 关闭检查点文件
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
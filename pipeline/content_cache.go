@@ -0,0 +1,140 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sync"
+
+	"atmb/model"
+)
+
+// cachedVerification 是上次运行中某个地点的内容哈希及其 Smarty 验证结果
+type cachedVerification struct {
+	Hash      string  `json:"hash"`
+	CMRA      string  `json:"cmra"`
+	RDI       string  `json:"rdi"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	MatchTier string  `json:"match_tier,omitempty"`
+
+	County                string `json:"county,omitempty"`
+	Vacant                string `json:"vacant,omitempty"`
+	RecordType            string `json:"record_type,omitempty"`
+	CongressionalDistrict string `json:"congressional_district,omitempty"`
+	Candidates            int    `json:"candidates,omitempty"`
+	LowConfidence         bool   `json:"low_confidence,omitempty"`
+}
+
+// newCachedVerification 保存地址的内容哈希和验证结果
+func newCachedVerification(addr *model.Address) cachedVerification {
+	return cachedVerification{
+		Hash:                  addr.ContentHash(),
+		CMRA:                  addr.CMRA,
+		RDI:                   addr.RDI,
+		Latitude:              addr.Latitude,
+		Longitude:             addr.Longitude,
+		MatchTier:             addr.MatchTier,
+		County:                addr.County,
+		Vacant:                addr.Vacant,
+		RecordType:            addr.RecordType,
+		CongressionalDistrict: addr.CongressionalDistrict,
+		Candidates:            addr.Candidates,
+		LowConfidence:         addr.LowConfidence,
+	}
+}
+
+// apply 将保存的验证结果写回地址
+func (c cachedVerification) apply(addr *model.Address) {
+	addr.CMRA, addr.RDI = c.CMRA, c.RDI
+	addr.Latitude, addr.Longitude = c.Latitude, c.Longitude
+	addr.MatchTier = c.MatchTier
+	addr.County, addr.Vacant = c.County, c.Vacant
+	addr.RecordType, addr.CongressionalDistrict = c.RecordType, c.CongressionalDistrict
+	addr.Candidates, addr.LowConfidence = c.Candidates, c.LowConfidence
+}
+
+// ContentCache 按 Link 保存各地点卡片的内容哈希和验证结果。
+// 卡片内容与上次运行相同的地点直接复用上次的 CMRA/RDI，不再调用 Smarty。
+type ContentCache struct {
+	mu       sync.Mutex
+	previous map[string]cachedVerification // 上次运行保存的结果
+	current  map[string]cachedVerification // 本次运行复用或新验证的结果，运行结束后保存
+}
+
+// LoadContentCache 读取缓存文件，文件不存在时返回空缓存
+func LoadContentCache(filename string) (*ContentCache, error) {
+	cache := &ContentCache{
+		previous: map[string]cachedVerification{},
+		current:  map[string]cachedVerification{},
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cache, nil
+		}
+		return nil, fmt.Errorf("读取内容哈希缓存失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &cache.previous); err != nil {
+		return nil, fmt.Errorf("解析内容哈希缓存失败: %w", err)
+	}
+	return cache, nil
+}
+
+// Len 返回上次运行保存的地点数量
+func (c *ContentCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.previous)
+}
+
+// Reuse 在地点卡片内容未变化时将上次的验证结果写回地址并返回 true
+func (c *ContentCache) Reuse(addr *model.Address) bool {
+	if addr.Link == "" {
+		return false
+	}
+	hash := addr.ContentHash()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.previous[addr.Link]
+	if !ok || cached.Hash != hash {
+		return false
+	}
+	cached.apply(addr)
+	c.current[addr.Link] = cached
+	return true
+}
+
+// Store 记录地址本次的内容哈希和验证结果
+func (c *ContentCache) Store(addr *model.Address) {
+	if addr.Link == "" {
+		return
+	}
+	entry := newCachedVerification(addr)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.current[addr.Link] = entry
+}
+
+// Save 将本次运行的结果写入缓存文件。
+// prune 为 true (本次运行覆盖了所有地点) 时，本次没有出现的地点 (已下架或验证失败) 不会保留；
+// 否则保留上次运行中这些地点的结果，避免只抓取部分州或中途结束的运行清空其余地点的缓存。
+func (c *ContentCache) Save(filename string, prune bool) error {
+	c.mu.Lock()
+	entries := c.current
+	if !prune {
+		entries = make(map[string]cachedVerification, len(c.previous)+len(c.current))
+		maps.Copy(entries, c.previous)
+		maps.Copy(entries, c.current)
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("格式化内容哈希缓存失败: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("写入内容哈希缓存失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"testing"
+
+	"atmb/model"
+)
+
+func TestContentCacheSave(t *testing.T) {
+	seen := &model.Address{Street: "1 Main St", City: "Austin", State: "TX", Zip: "78701", Link: "https://example.com/seen", CMRA: "N", RDI: "Commercial"}
+	unseen := &model.Address{Street: "2 Oak St", City: "Boston", State: "MA", Zip: "02108", Link: "https://example.com/unseen", CMRA: "Y", RDI: "Residential"}
+
+	for _, tt := range []struct {
+		name      string
+		prune     bool
+		wantLinks []string
+	}{
+		{name: "部分运行保留上次的其他地点", prune: false, wantLinks: []string{seen.Link, unseen.Link}},
+		{name: "完整运行删除本次没有出现的地点", prune: true, wantLinks: []string{seen.Link}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "content_hashes.json")
+			cache, err := LoadContentCache(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cache.previous[unseen.Link] = newCachedVerification(unseen)
+			cache.Store(seen)
+			if err := cache.Save(filename, tt.prune); err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := LoadContentCache(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(saved.previous) != len(tt.wantLinks) {
+				t.Fatalf("缓存中有 %d 个地点，want %d", len(saved.previous), len(tt.wantLinks))
+			}
+			for _, link := range tt.wantLinks {
+				if _, ok := saved.previous[link]; !ok {
+					t.Errorf("缓存中缺少 %s", link)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package pipeline
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"atmb/model"
+)
+
+// feedAddresses 将 Config.Addresses 中的地址推送到 jobs，代替抓取工作单元
+func (r *runner) feedAddresses(addresses []*model.Address, jobs chan<- *model.Address, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for i, addr := range addresses {
+		addr.ID = newJobID("input", i)
+		if !r.seen.FirstSeen(addr) {
+			logJob(withJobID(context.Background(), addr.ID), "[Input] 跳过重复的地址: %s, %s, %s %s", addr.Street, addr.City, addr.State, addr.Zip)
+			continue
+		}
+		select {
+		case jobs <- addr:
+			r.profile.Produced()
+			r.progress.Discovered()
+		case <-stop:
+			log.Println("[Input] 收到关闭信号，停止推送输入地址。")
+			return
+		}
+	}
+	log.Printf("[Input] 已推送全部 %d 个输入地址。", len(addresses))
+}
@@ -0,0 +1,119 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+)
+
+// 支持的日志格式
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// jobIDKey 是 context 中保存任务关联 ID 的键
+type jobIDKey struct{}
+
+// withJobID 返回携带任务关联 ID 的 context
+func withJobID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, jobIDKey{}, id)
+}
+
+// jobIDFrom 返回 context 中的任务关联 ID，没有时返回空字符串
+func jobIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey{}).(string)
+	return id
+}
+
+// logAttrsKey 是 context 中保存结构化日志字段的键
+type logAttrsKey struct{}
+
+// withLogAttrs 返回附加了结构化日志字段 (如工作单元编号、州、地址) 的 context。
+// 使用 JSON 日志格式时，这些字段会输出到通过该 context 记录的每条日志中。
+func withLogAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+	return context.WithValue(ctx, logAttrsKey{}, append(slices.Clip(existing), attrs...))
+}
+
+// newJobID 为某个州抓取到的第 index 个 (从 0 开始) 地址生成关联 ID，如 new-york-12。
+// 同一个地址从抓取到验证、写入失败文件的整个过程都使用这个 ID，便于在交错的日志中追踪。
+func newJobID(state string, index int) string {
+	slug := strings.Join(strings.Fields(strings.ToLower(state)), "-")
+	return fmt.Sprintf("%s-%d", slug, index+1)
+}
+
+// contextHandler 在每条日志中附加 context 携带的任务关联 ID。
+// structured 为 true (JSON 日志格式) 时，还会附加 withLogAttrs 设置的所有字段；
+// 文本格式下这些信息已经包含在日志内容中，不再重复输出。
+type contextHandler struct {
+	slog.Handler
+	structured bool
+}
+
+// Handle 实现 slog.Handler 接口
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := jobIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("job", id))
+	}
+	if h.structured {
+		attrs, _ := ctx.Value(logAttrsKey{}).([]slog.Attr)
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs 实现 slog.Handler 接口
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs), h.structured}
+}
+
+// WithGroup 实现 slog.Handler 接口
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name), h.structured}
+}
+
+// jobLogger 输出与单个任务相关的日志，格式与标准 log 包一致，末尾附加 job=<关联 ID>
+var jobLogger = slog.New(contextHandler{Handler: slog.Default().Handler()})
+
+// ConfigureLogging 按 -log-format 设置日志格式 (text 或 json)。json 格式下所有日志 (包括标准 log 包输出的日志)
+// 都以 JSON 行写入标准错误，与任务相关的日志额外带有工作单元、州、地址、尝试次数、错误等字段。
+func ConfigureLogging(format string) error {
+	switch format {
+	case logFormatText:
+		return nil
+	case logFormatJSON:
+		handler := slog.NewJSONHandler(os.Stderr, nil)
+		slog.SetDefault(slog.New(handler))
+		jobLogger = slog.New(contextHandler{Handler: handler, structured: true})
+		return nil
+	}
+	return fmt.Errorf("不支持的日志格式: %s (可选 %s, %s)", format, logFormatText, logFormatJSON)
+}
+
+// logJob 以 Printf 的格式输出一条与任务相关的日志
+func logJob(ctx context.Context, format string, args ...any) {
+	jobLogger.InfoContext(ctx, fmt.Sprintf(format, args...))
+}
+
+// logJobErr 与 logJob 相同，JSON 日志格式下额外输出 error 字段
+func logJobErr(ctx context.Context, err error, format string, args ...any) {
+	logJob(withLogAttrs(ctx, slog.Any("error", err)), format, args...)
+}
+
+// jobContext 返回处理 job 时使用的 context，携带地址的关联 ID 和结构化日志字段
+func jobContext(ctx context.Context, worker int, job *retryJob) context.Context {
+	addr := job.addr
+	return withLogAttrs(withJobID(ctx, addr.ID),
+		slog.Int("worker", worker),
+		slog.String("state", addr.State),
+		slog.String("address", addr.Street+", "+addr.City),
+		slog.Int("attempt", job.attempt),
+	)
+}
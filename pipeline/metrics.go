@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"atmb/verify"
+)
+
+// smartyResultCounts 按结果统计 Smarty 查询次数 (批量请求中的每个地址计一次)，可被多个工作单元并发使用
+type smartyResultCounts struct {
+	mutex  sync.Mutex
+	counts map[string]int64
+}
+
+// Record 记录一次查询的结果：成功为 success，请求被取消为 canceled，其他错误为其类别 (如 unknown-address)
+func (c *smartyResultCounts) Record(err error) {
+	result := "success"
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		result = "canceled"
+	default:
+		result = string(verify.Classify(err))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.counts[result]++
+}
+
+// snapshot 返回按结果排序的计数副本
+func (c *smartyResultCounts) snapshot() ([]string, map[string]int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	results := make([]string, 0, len(c.counts))
+	for result, n := range c.counts {
+		counts[result] = n
+		results = append(results, result)
+	}
+	sort.Strings(results)
+	return results, counts
+}
+
+// latencyBuckets 是 Smarty 请求耗时直方图的桶上限
+var latencyBuckets = []time.Duration{
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+}
+
+// writeMetrics 以 Prometheus 文本格式写出运行指标。地址计数与进度日志使用同一组计数器，
+// 耗时直方图由 r.latency 中记录的每次请求耗时计算。
+func (r *runner) writeMetrics(w io.Writer) {
+	progress := r.progress.Snapshot()
+	writeMetric(w, "atmb_states_total", "gauge", "本次运行要抓取的州数量", progress.TotalStates)
+	writeMetric(w, "atmb_states_scraped_total", "counter", "已抓取完毕的州数量", progress.StatesDone)
+	writeMetric(w, "addresses_discovered_total", "counter", "推送到验证队列的地址数量", progress.Discovered)
+	writeMetric(w, "addresses_processed_total", "counter", "处理完毕 (成功或最终失败) 的地址数量", progress.Processed)
+	writeMetric(w, "addresses_failed_total", "counter", "最终失败的地址数量", progress.Failed)
+	writeMetric(w, "credentials_remaining", "gauge", "尚有剩余额度的 Smarty 凭证数量", int64(r.apiManager.RemainingCredentials()))
+
+	results, counts := r.smartyResults.snapshot()
+	fmt.Fprintln(w, "# HELP smarty_requests_total Smarty 查询次数 (批量请求中的每个地址计一次)，按结果分类")
+	fmt.Fprintln(w, "# TYPE smarty_requests_total counter")
+	for _, result := range results {
+		fmt.Fprintf(w, "smarty_requests_total{result=%q} %d\n", result, counts[result])
+	}
+
+	cumulative, sum, count := r.latency.Histogram(latencyBuckets)
+	fmt.Fprintln(w, "# HELP smarty_request_duration_seconds 每次 Smarty HTTP 请求的耗时")
+	fmt.Fprintln(w, "# TYPE smarty_request_duration_seconds histogram")
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "smarty_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), cumulative[i])
+	}
+	fmt.Fprintf(w, "smarty_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", count)
+	fmt.Fprintf(w, "smarty_request_duration_seconds_sum %g\n", sum.Seconds())
+	fmt.Fprintf(w, "smarty_request_duration_seconds_count %d\n", count)
+}
+
+// writeMetric 写出一个不带标签的指标
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
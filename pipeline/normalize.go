@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"atmb/model"
+)
+
+// streetAbbreviations 是 USPS 标准的街道类型、方位词和二级地址缩写，键为小写的完整写法
+var streetAbbreviations = map[string]string{
+	"street": "St", "avenue": "Ave", "road": "Rd", "boulevard": "Blvd", "drive": "Dr",
+	"lane": "Ln", "court": "Ct", "place": "Pl", "parkway": "Pkwy", "highway": "Hwy",
+	"circle": "Cir", "terrace": "Ter", "square": "Sq", "expressway": "Expy", "freeway": "Fwy",
+	"north": "N", "south": "S", "east": "E", "west": "W",
+	"northeast": "NE", "northwest": "NW", "southeast": "SE", "southwest": "SW",
+	"suite": "Ste", "building": "Bldg", "floor": "Fl", "apartment": "Apt",
+}
+
+// abbreviationRe 匹配 streetAbbreviations 中的完整单词
+var abbreviationRe = regexp.MustCompile(`(?i)\b(` + strings.Join(mapKeys(streetAbbreviations), "|") + `)\b`)
+
+// mapKeys 返回 map 的键，用于拼接正则表达式
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// normalizeText 解码 HTML 实体 (如 &nbsp;、&amp;)，把各种空白 (包括不换行空格) 合并为单个空格，
+// 并去掉首尾多余的标点
+func normalizeText(value string) string {
+	value = html.UnescapeString(value)
+	value = strings.Join(strings.FieldsFunc(value, unicode.IsSpace), " ")
+	return strings.TrimRight(strings.TrimLeft(value, ",;: "), ",;: ")
+}
+
+// abbreviate 把 value 中的完整写法替换为标准缩写
+func abbreviate(value string) string {
+	return abbreviationRe.ReplaceAllStringFunc(value, func(word string) string {
+		return streetAbbreviations[strings.ToLower(word)]
+	})
+}
+
+// normalizeAddress 在发送给 Smarty 之前清理抓取到的地址字段：多余的空白、不换行空格、HTML 实体和首尾标点，
+// 州名统一为大写；Config.AbbreviateStreet 为 true 时还会把街道中常见的完整写法换成 USPS 标准缩写 (如 Street -> St)。
+// 字段发生变化时记录日志。标题、价格和链接等不参与验证的字段保持原样。
+func (r *runner) normalizeAddress(ctx context.Context, addr *model.Address) {
+	street := func(v string) string { return normalizeStreet(v, r.cfg.AbbreviateStreet) }
+	fields := []struct {
+		name  string
+		value *string
+		clean func(string) string
+	}{
+		{"Street", &addr.Street, street},
+		{"Secondary", &addr.Secondary, street},
+		{"City", &addr.City, normalizeText},
+		{"State", &addr.State, func(v string) string { return strings.ToUpper(normalizeText(v)) }},
+		{"Zip", &addr.Zip, normalizeText},
+	}
+	for _, field := range fields {
+		if cleaned := field.clean(*field.value); cleaned != *field.value {
+			logJob(ctx, "[Normalize] %s: %q -> %q", field.name, *field.value, cleaned)
+			*field.value = cleaned
+		}
+	}
+}
+
+// normalizeStreet 清理街道和二级地址，shorten 为 true 时还会缩写常见单词
+func normalizeStreet(value string, shorten bool) string {
+	value = normalizeText(value)
+	if shorten {
+		value = abbreviate(value)
+	}
+	return value
+}
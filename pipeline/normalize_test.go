@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"testing"
+
+	"atmb/model"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := map[string]string{
+		"100  Congress\tAve":    "100 Congress Ave",
+		"100\u00a0Congress Ave": "100 Congress Ave",
+		"100&nbsp;Congress Ave": "100 Congress Ave",
+		"Smith &amp; Sons":      "Smith & Sons",
+		"  , Austin ; ":         "Austin",
+		"Suite 200,":            "Suite 200",
+		"\n 78701 \n":           "78701",
+		"":                      "",
+		"1600 17th St, Ste 200": "1600 17th St, Ste 200",
+		"Washington, D.C.":      "Washington, D.C.",
+	}
+	for in, want := range tests {
+		if got := normalizeText(in); got != want {
+			t.Errorf("normalizeText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAbbreviate(t *testing.T) {
+	tests := map[string]string{
+		"100 North Congress Avenue": "100 N Congress Ave",
+		"2995 PEARL STREET":         "2995 PEARL St",
+		"1 Main St Suite 200":       "1 Main St Ste 200",
+		"500 Southwest Parkway":     "500 SW Pkwy",
+		// 只替换完整的单词
+		"12 Streetsboro Rd":  "12 Streetsboro Rd",
+		"77 Westbrook Drive": "77 Westbrook Dr",
+	}
+	for in, want := range tests {
+		if got := abbreviate(in); got != want {
+			t.Errorf("abbreviate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	raw := model.Address{
+		Title:     "Austin&nbsp;-  Congress Ave",
+		Street:    " 100 North Congress  Avenue ",
+		Secondary: "Suite&nbsp;200,",
+		City:      "Austin ,",
+		State:     " tx",
+		Zip:       "78701 ",
+	}
+	tests := []struct {
+		abbreviate bool
+		want       model.Address
+	}{
+		{
+			abbreviate: false,
+			want: model.Address{
+				Title:  raw.Title,
+				Street: "100 North Congress Avenue", Secondary: "Suite 200",
+				City: "Austin", State: "TX", Zip: "78701",
+			},
+		},
+		{
+			abbreviate: true,
+			want: model.Address{
+				Title:  raw.Title,
+				Street: "100 N Congress Ave", Secondary: "Ste 200",
+				City: "Austin", State: "TX", Zip: "78701",
+			},
+		},
+	}
+	for _, tt := range tests {
+		addr := raw
+		newRunner(Config{AbbreviateStreet: tt.abbreviate}).normalizeAddress(t.Context(), &addr)
+		if addr != tt.want {
+			t.Errorf("AbbreviateStreet=%v: normalizeAddress() =\n%+v\nwant\n%+v", tt.abbreviate, addr, tt.want)
+		}
+	}
+}
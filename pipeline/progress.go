@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// progressTracker 统计整个运行的进度：已抓取的州、推送到验证队列的地址，以及验证成功和最终失败的地址。
+// 地址只在处理完毕 (成功或放弃) 时计数一次，重试和凭证轮换不会重复计数。
+type progressTracker struct {
+	totalStates atomic.Int64
+	statesDone  atomic.Int64
+	discovered  atomic.Int64
+	verified    atomic.Int64
+	failed      atomic.Int64
+}
+
+func (p *progressTracker) SetTotalStates(n int) { p.totalStates.Store(int64(n)) }
+func (p *progressTracker) StateDone()           { p.statesDone.Add(1) }
+func (p *progressTracker) Discovered()          { p.discovered.Add(1) }
+
+// Finished 记录一个处理完毕的地址，ok 表示验证成功并写入结果
+func (p *progressTracker) Finished(ok bool) {
+	if ok {
+		p.verified.Add(1)
+	} else {
+		p.failed.Add(1)
+	}
+}
+
+// Progress 是某一时刻的进度，由状态服务的 /status 以 JSON 返回
+type Progress struct {
+	TotalStates int64 `json:"total_states"`
+	StatesDone  int64 `json:"states_done"`
+	Discovered  int64 `json:"discovered"`
+	Processed   int64 `json:"processed"`
+	Verified    int64 `json:"verified"`
+	Failed      int64 `json:"failed"`
+	Pending     int64 `json:"pending"`
+}
+
+// Snapshot 读取当前的进度计数
+func (p *progressTracker) Snapshot() Progress {
+	discovered, verified, failed := p.discovered.Load(), p.verified.Load(), p.failed.Load()
+	return Progress{
+		TotalStates: p.totalStates.Load(),
+		StatesDone:  p.statesDone.Load(),
+		Discovered:  discovered,
+		Processed:   verified + failed,
+		Verified:    verified,
+		Failed:      failed,
+		Pending:     discovered - verified - failed,
+	}
+}
+
+// Log 输出一次当前进度
+func (p *progressTracker) Log(start time.Time) {
+	discovered, verified, failed := p.discovered.Load(), p.verified.Load(), p.failed.Load()
+	processed := verified + failed
+	percent := 0.0
+	if discovered > 0 {
+		percent = 100 * float64(processed) / float64(discovered)
+	}
+	elapsed := time.Since(start).Round(time.Second)
+	if total := p.totalStates.Load(); total > 0 {
+		log.Printf("[进度] 已抓取 %d/%d 个州，发现 %d 个地址，已处理 %d 个 (%.1f%%，成功 %d，失败 %d)，待处理 %d 个，已运行 %v",
+			p.statesDone.Load(), total, discovered, processed, percent, verified, failed, discovered-processed, elapsed)
+		return
+	}
+	log.Printf("[进度] 发现 %d 个地址，已处理 %d 个 (%.1f%%，成功 %d，失败 %d)，待处理 %d 个，已运行 %v",
+		discovered, processed, percent, verified, failed, discovered-processed, elapsed)
+}
+
+// Report 每隔 interval 输出一次进度，直到 stop 被关闭
+func (p *progressTracker) Report(interval time.Duration, stop <-chan struct{}) {
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.Log(start)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"log"
+	"sync"
+
+	"atmb/verify"
+)
+
+// retryCounts 是单个错误类别的重试统计
+type retryCounts struct {
+	retries   int // 该类别错误触发的重试次数
+	succeeded int // 经历过该类别错误、最终成功的地址数
+	failed    int // 经历过该类别错误、最终失败的地址数
+}
+
+// retryMetrics 按错误类别统计重试情况，可被多个工作单元并发使用
+type retryMetrics struct {
+	mutex  sync.Mutex
+	counts map[verify.ErrorCategory]*retryCounts
+}
+
+func newRetryMetrics() *retryMetrics {
+	return &retryMetrics{counts: make(map[verify.ErrorCategory]*retryCounts)}
+}
+
+// get 返回类别对应的计数 (非线程安全，需要被外部调用者加锁)
+func (m *retryMetrics) get(category verify.ErrorCategory) *retryCounts {
+	c, ok := m.counts[category]
+	if !ok {
+		c = &retryCounts{}
+		m.counts[category] = c
+	}
+	return c
+}
+
+// RecordRetry 记录一次由 category 类别错误触发的重试
+func (m *retryMetrics) RecordRetry(category verify.ErrorCategory) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.get(category).retries++
+}
+
+// RecordOutcome 记录一个地址的最终结果，categories 是该地址处理过程中遇到的错误类别
+func (m *retryMetrics) RecordOutcome(categories map[verify.ErrorCategory]bool, success bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for category := range categories {
+		if success {
+			m.get(category).succeeded++
+		} else {
+			m.get(category).failed++
+		}
+	}
+}
+
+// LogSummary 输出各错误类别的重试统计
+func (m *retryMetrics) LogSummary() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.counts) == 0 {
+		log.Println("重试统计: 本次运行没有发生重试。")
+		return
+	}
+	log.Println("重试统计 (按错误类别):")
+	for _, category := range verify.Categories {
+		c, ok := m.counts[category]
+		if !ok {
+			continue
+		}
+		log.Printf("  %-18s 重试 %d 次，最终成功 %d 个，最终失败 %d 个", category, c.retries, c.succeeded, c.failed)
+	}
+}
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"atmb/model"
+	"atmb/verify"
+)
+
+// retryJob 是验证工作单元处理的一个任务，记录地址已经尝试的次数，
+// 以便重试时从上次的进度继续。
+type retryJob struct {
+	addr    *model.Address
+	attempt int // 已失败的尝试次数，首次处理时为 0
+	// categories 记录该地址处理过程中遇到过的错误类别，用于重试统计
+	categories map[verify.ErrorCategory]bool
+}
+
+// retryQueue 将 jobs 中的新地址和退避结束的重试任务合并到同一个 work 通道，
+// 验证工作单元在等待退避期间可以继续处理其他地址，而不是原地休眠。
+// 等待退避的任务按到期时间保存在 delayed 中，由单个调度协程在到期时放回 work，
+// 不为每个重试单独占用协程或工作单元。
+// 所有新地址和重试都处理完毕后 work 通道会被关闭，工作单元随之退出。
+type retryQueue struct {
+	work chan *retryJob
+
+	mu          sync.Mutex
+	inflight    int        // 已进入队列但尚未处理完毕的任务数 (包括等待退避的重试)
+	inputClosed bool       // jobs 是否已关闭并读完
+	delayed     delayQueue // 等待退避结束的重试任务
+	// wake 在加入新的重试任务时通知调度协程重新计算等待时间；drained 在 work 关闭时关闭，调度协程随之退出
+	wake    chan struct{}
+	drained chan struct{}
+}
+
+// newRetryQueue 创建重试队列并开始从 jobs 读取新地址。
+// work 最多缓冲 buffer 个已就绪的任务，供工作单元一次取出合并为批量请求。
+// ctx 被取消后，等待退避的任务立即放回 work，由工作单元按关闭流程处理，而不是继续等待。
+func newRetryQueue(ctx context.Context, jobs <-chan *model.Address, buffer int) *retryQueue {
+	q := &retryQueue{
+		work:    make(chan *retryJob, buffer),
+		wake:    make(chan struct{}, 1),
+		drained: make(chan struct{}),
+	}
+	go q.feed(jobs)
+	go q.schedule(ctx)
+	return q
+}
+
+// feed 将新地址转换为任务推送到 work，jobs 关闭后标记输入结束
+func (q *retryQueue) feed(jobs <-chan *model.Address) {
+	for addr := range jobs {
+		q.mu.Lock()
+		q.inflight++
+		q.mu.Unlock()
+		q.work <- &retryJob{addr: addr, categories: make(map[verify.ErrorCategory]bool)}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inputClosed = true
+	q.closeIfDrained()
+}
+
+// nextBatch 在已取出 first 的基础上，不等待地继续读取 work 中已就绪的任务，最多凑满 size 个。
+// 队列中没有积压时批次只包含 first，不会为了凑满批次而延迟处理。
+func (q *retryQueue) nextBatch(first *retryJob, size int) []*retryJob {
+	batch := []*retryJob{first}
+	for len(batch) < size {
+		select {
+		case job, ok := <-q.work:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, job)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// Retry 在 delay 之后将任务重新放回 work，调用方不会被阻塞
+func (q *retryQueue) Retry(job *retryJob, delay time.Duration) {
+	q.mu.Lock()
+	heap.Push(&q.delayed, delayedJob{job: job, due: time.Now().Add(delay)})
+	q.mu.Unlock()
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// schedule 在最早的重试任务到期时将其放回 work，直到所有任务处理完毕。
+// ctx 被取消后不再等待，所有等待中和之后加入的重试任务都立即放回。
+func (q *retryQueue) schedule(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		// 取出所有已到期的任务，并计算下一个任务的等待时间
+		q.mu.Lock()
+		var due []*retryJob
+		for q.delayed.Len() > 0 && (ctx.Err() != nil || !q.delayed[0].due.After(time.Now())) {
+			due = append(due, heap.Pop(&q.delayed).(delayedJob).job)
+		}
+		wait := time.Duration(-1)
+		if q.delayed.Len() > 0 {
+			wait = time.Until(q.delayed[0].due)
+		}
+		q.mu.Unlock()
+
+		// 放回 work 时可能因缓冲已满而阻塞，此时不持有锁，工作单元仍可以加入新的重试
+		for _, job := range due {
+			q.work <- job
+		}
+
+		timer.Stop()
+		var fire <-chan time.Time
+		if wait >= 0 {
+			timer.Reset(wait)
+			fire = timer.C
+		}
+		done := ctx.Done()
+		if ctx.Err() != nil {
+			done = nil // 已取消时只需等待新的重试任务，避免空转
+		}
+		select {
+		case <-fire:
+		case <-q.wake:
+		case <-done:
+		case <-q.drained:
+			return
+		}
+	}
+}
+
+// Done 标记一个任务已处理完毕 (成功或最终失败)
+func (q *retryQueue) Done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.inflight--
+	q.closeIfDrained()
+}
+
+// closeIfDrained 在输入已结束且没有未完成的任务时关闭 work (需要调用方加锁)
+func (q *retryQueue) closeIfDrained() {
+	if q.inputClosed && q.inflight == 0 {
+		close(q.work)
+		close(q.drained)
+	}
+}
+
+// delayedJob 是一个等待退避结束的重试任务
+type delayedJob struct {
+	job *retryJob
+	due time.Time
+}
+
+// delayQueue 是按到期时间排序的最小堆，实现 heap.Interface
+type delayQueue []delayedJob
+
+func (d delayQueue) Len() int           { return len(d) }
+func (d delayQueue) Less(i, j int) bool { return d[i].due.Before(d[j].due) }
+func (d delayQueue) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d *delayQueue) Push(x any)        { *d = append(*d, x.(delayedJob)) }
+func (d *delayQueue) Pop() any {
+	old := *d
+	item := old[len(old)-1]
+	*d = old[:len(old)-1]
+	return item
+}
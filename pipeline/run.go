@@ -0,0 +1,426 @@
+// Package pipeline 负责抓取 ATMB 各州的地点、通过 Smarty 验证地址并写入结果的完整流程。
+// 所有设置都通过 Config 传入，可以嵌入其他 Go 程序使用；命令行程序只负责解析参数并调用 Run。
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"atmb/credential"
+	"atmb/model"
+	"atmb/output"
+	"atmb/scrape"
+	"atmb/verify"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+)
+
+// Config 是一次运行 (抓取并验证地址) 的全部设置。
+// 零值字段表示关闭对应的功能，或使用字段说明中的默认值。
+type Config struct {
+	// States 是要抓取的州 slug；Addresses 不为 nil 时不再抓取，直接验证这些地址
+	States    []string
+	Addresses []*model.Address
+	// Threshold 是各州的最低地址数量，抓取到的地址不足时发出警告并按配置重新抓取
+	Threshold StateThreshold
+	// AvailableOnly 为 true 时跳过尚未开业的地点；SamplePerState 大于 0 时每个州最多推送这么多个地址去验证
+	AvailableOnly  bool
+	SamplePerState int
+
+	// Credentials 是初始的 Smarty 凭证，ValidateCredentials 为 true 时在开始前逐个验证
+	Credentials         []credential.ApiCredential
+	ValidateCredentials bool
+	// MaxLookups 是本次运行 Smarty 查询总次数的上限，所有凭证共用，0 表示不限制
+	MaxLookups int64
+
+	// ATMBWorkers 和 SmartyWorkers 是抓取和验证工作单元的数量，WorkerRamp 是它们错开启动的总时长
+	ATMBWorkers, SmartyWorkers int
+	WorkerRamp                 time.Duration
+
+	// HTTPClient 是所有 Smarty 客户端共用的 HTTP 客户端，为 nil 时使用 SDK 默认的客户端；
+	// SDKMaxRetry 是 SDK 内部对网络错误的重试次数，小于 0 时使用 SDK 默认值
+	HTTPClient  *http.Client
+	SDKMaxRetry int
+	// BatchSize 是每次批量请求最多包含的地址数量 (0 表示 verify.MaxBatchSize)，
+	// BatchTimeout 是每次批量请求 (包括 SDK 内部的重试) 的期限 (0 表示不限制)
+	BatchSize    int
+	BatchTimeout time.Duration
+	// MatchChain 是依次尝试的匹配策略 (为空时只使用 strict)，MaxCandidates 是每个地址最多返回的候选数量
+	MatchChain    []street.MatchStrategy
+	MaxCandidates int
+	// SlowThreshold 大于 0 时单独记录耗时超过该值的请求；RecordDir 不为空时把每次响应按地址保存到该目录
+	SlowThreshold time.Duration
+	RecordDir     string
+	// ReplayDir 不为空时从该目录回放已保存的响应，不调用 Smarty；
+	// DryRun 为 true 时照常抓取但不验证，地址的 CMRA/RDI 保持 UNKNOWN
+	ReplayDir string
+	DryRun    bool
+	// AutocompleteFallback 为 true 时对无法验证的地址查询 Autocomplete 建议
+	AutocompleteFallback bool
+	// AbbreviateStreet 为 true 时验证前把街道中的常见单词换成 USPS 标准缩写
+	AbbreviateStreet bool
+
+	// RetryPolicy 决定验证失败后的处理方式，为 nil 时使用 verify.DefaultRetryPolicy。
+	// 可以重试的地址最多重试 MaxRetries 次，第 n 次重试前等待 InitialBackoff * 2^(n-1)，不超过 MaxBackoff
+	// (为 0 时分别使用 DefaultInitialBackoff 和 DefaultMaxBackoff)
+	RetryPolicy    verify.RetryPolicy
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// HashCache 不为 nil 时，卡片内容与上次运行相同的地点直接复用上次的验证结果 (见 LoadContentCache)
+	HashCache *ContentCache
+	// Checkpoint 不为 nil 时跳过检查点中已经验证过的地址，并记录新验证成功的地址 (见 OpenCheckpoint)
+	Checkpoint *Checkpoint
+
+	// Writer 消费验证成功的结果，可以替换为自定义实现以流式接收结果
+	Writer output.OutputWriter
+	// AppendResults 为 true 表示 Writer 追加到上次运行的结果文件 (如 output.AppendCSV)，
+	// 从 Checkpoint 恢复的地址已经在文件中，只计入进度，不再写入
+	AppendResults bool
+	// OnlyNonCMRA 为 true 时只写入非 CMRA 地址，CMRA 状态未知的地址按 UnknownCMRA 处理
+	OnlyNonCMRA bool
+	UnknownCMRA string
+	// FailedFile 是失败任务文件的路径，StreamFailed 为 true 时失败任务在产生时立即写入文件
+	FailedFile   string
+	StreamFailed bool
+
+	// StatusAddr 不为空时在该地址上启动状态服务
+	StatusAddr string
+	// ProgressInterval 大于 0 时按该间隔输出进度，设置了 MaxLookups 时同样按该间隔 (为 0 时按 30 秒) 输出查询预算的使用情况；
+	// ParallelismReport 大于 0 时按该间隔记录抓取和验证阶段的吞吐量，并在结束时输出报告
+	ProgressInterval  time.Duration
+	ParallelismReport time.Duration
+	// HandleSignals 为 true 时处理 SIGINT/SIGTERM，收到信号后按 CauseSignal 走关闭流程
+	HandleSignals bool
+	// DrainOnShutdown 为 true 时，关闭后继续处理已排队的地址，最多等待 ShutdownGrace；
+	// 为 false 时立即取消请求，已排队的地址直接记为失败
+	DrainOnShutdown bool
+	ShutdownGrace   time.Duration
+}
+
+// Results 汇总一次运行的结果
+type Results struct {
+	// Cause 是运行结束的原因，决定进程的退出码
+	Cause ShutdownCause
+	// Progress 是运行结束时的进度计数，包括验证成功和最终失败的地址数量
+	Progress Progress
+	// Stats 是写入结果的地址的 CMRA、RDI 和各州统计
+	Stats *output.ResultStats
+	// StateCounts 是各州 (slug) 实际抓取到的地址数量，StateErrors 是抓取失败而被跳过的州
+	StateCounts map[string]int
+	StateErrors []StateError
+	// Credentials 是运行结束时的凭证列表 (包括运行中补充的凭证)，用于写回凭证来源
+	Credentials []credential.ApiCredential
+	// CredentialsUsed 是本次运行中发送过查询的凭证数量，Lookups 是发送给 Smarty 的查询次数
+	CredentialsUsed int
+	Lookups         int64
+}
+
+// runner 保存一次运行的设置和统计，由 Run 创建，所有工作单元共用
+type runner struct {
+	cfg        Config
+	apiManager *credential.APIManager
+	metrics    *retryMetrics
+	budget     *lookupBudget
+	progress   *progressTracker
+	profile    *stageProfiler
+	seen       *addressDeduper
+	states     *stateLog
+	// smartyResults 和 latency 是 Smarty 查询的结果和耗时统计，由 /metrics 导出
+	smartyResults *smartyResultCounts
+	latency       *verify.LatencyStats
+	// shutdown 触发关闭流程，Run 在启动工作单元前设置
+	shutdown func(ShutdownCause)
+}
+
+// newRunner 按 cfg 创建一次运行，未设置的字段使用默认值
+func newRunner(cfg Config) *runner {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = verify.MaxBatchSize
+	}
+	if cfg.RetryPolicy == nil {
+		cfg.RetryPolicy = verify.DefaultRetryPolicy{}
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = DefaultInitialBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = DefaultMaxBackoff
+	}
+	return &runner{
+		cfg:           cfg,
+		apiManager:    credential.NewAPIManager(cfg.Credentials),
+		metrics:       newRetryMetrics(),
+		budget:        newLookupBudget(cfg.MaxLookups),
+		progress:      &progressTracker{},
+		profile:       &stageProfiler{start: time.Now()},
+		seen:          &addressDeduper{seen: make(map[string]bool)},
+		states:        newStateLog(),
+		smartyResults: &smartyResultCounts{counts: make(map[string]int64)},
+		latency:       &verify.LatencyStats{},
+		shutdown:      func(ShutdownCause) {},
+	}
+}
+
+// Run 执行一次完整的抓取和验证流程，所有工作单元退出、结果写入完毕后返回。
+// rootCtx 被取消或到期后，正在进行的抓取和 Smarty 请求都会被中止。
+// 只有在开始前发现配置无法运行 (如没有任何凭证通过验证) 时才返回错误。
+func Run(rootCtx context.Context, cfg Config) (Results, error) {
+	r := newRunner(cfg)
+	cfg = r.cfg
+	apiManager := r.apiManager
+	// 在开始抓取前发现填错的凭证，避免运行到一半才发现所有凭证都无法使用
+	if len(cfg.Credentials) > 0 && cfg.ValidateCredentials {
+		log.Printf("正在验证 %d 组凭证 (每组消耗一次查询，可以使用 -skip-validation 跳过)...", len(cfg.Credentials))
+		if apiManager.ValidateCredentials(rootCtx, r.checkCredential) == 0 {
+			return Results{}, errors.New("没有通过验证的凭证，请检查凭证中的 Auth ID 和 Auth Token")
+		}
+	}
+
+	// --- 1. 设置 Channels 和 WaitGroups ---
+	stateChan := make(chan string, len(cfg.States))
+	jobs := make(chan *model.Address, 1000)
+	results := make(chan *model.Address, 1000)
+	failedJobs := make(chan *model.Address, 1000)
+
+	var atmbWg, scrapyWg, csvWriterWg sync.WaitGroup
+
+	// stop 在触发关闭流程时被关闭，通知抓取工作单元停止推送新任务；
+	// ctx 被取消后中止正在进行的 Smarty 请求，jobs 中剩余的地址直接记为失败
+	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(rootCtx)
+	defer cancel()
+	var shutdownOnce sync.Once
+	// 定义一个函数，用于触发关闭流程，sync.Once 会保证它只被执行一次
+	initiateShutdown := func() {
+		close(stop)
+		if cfg.DrainOnShutdown {
+			log.Printf("检测到关闭信号。通知抓取工作单元停止推送新任务，继续处理队列中剩余的 %d 个地址 (最多 %v)。", len(jobs), cfg.ShutdownGrace)
+			time.AfterFunc(cfg.ShutdownGrace, func() {
+				log.Println("处理剩余队列超时，取消剩余的请求。")
+				cancel()
+			})
+			return
+		}
+		log.Printf("检测到关闭信号。通知抓取工作单元停止推送新任务，取消正在进行的请求，队列中剩余的 %d 个地址将记为失败。", len(jobs))
+		cancel()
+	}
+	// cause 只在第一次触发关闭时写入；所有工作单元退出后 (workersDone) 不再改变，
+	// 例如写入结果期间才到达运行期限或收到信号时，本次运行仍按已经完成处理
+	var causeMu sync.Mutex
+	cause := CauseCompleted
+	workersDone := false
+	r.shutdown = func(c ShutdownCause) {
+		causeMu.Lock()
+		defer causeMu.Unlock()
+		if workersDone {
+			return
+		}
+		shutdownOnce.Do(func() {
+			cause = c
+			log.Printf("关闭原因: %s", c)
+			initiateShutdown()
+		})
+	}
+
+	if cfg.HandleSignals {
+		stopSignals := handleSignals(r.shutdown)
+		defer stopSignals()
+	}
+	// rootCtx 到期或被取消时按对应的原因走关闭流程；此时 ctx 已随 rootCtx 一起取消，DrainOnShutdown 不再生效。
+	// 所有工作单元退出后关闭 watchDone 并等待该 goroutine 退出
+	watchDone := make(chan struct{})
+	watchExited := make(chan struct{})
+	go func() {
+		defer close(watchExited)
+		select {
+		case <-rootCtx.Done():
+			if errors.Is(rootCtx.Err(), context.DeadlineExceeded) {
+				log.Println("已达到运行期限。")
+			} else {
+				log.Println("运行已被取消。")
+			}
+			r.shutdown(contextCause(rootCtx.Err()))
+		case <-watchDone:
+		}
+	}()
+
+	r.profile.start = time.Now()
+	r.progress.SetTotalStates(len(cfg.States))
+	// 状态服务在记录开始时间之后启动，/status 读取的运行时长和计数都以此为准；
+	// Run 返回时 (所有结果写入之后) 关闭状态服务
+	if cfg.StatusAddr != "" {
+		stopStatusServer := r.startStatusServer(cfg.StatusAddr)
+		defer stopStatusServer()
+	}
+	if cfg.ProgressInterval > 0 {
+		progressStop := make(chan struct{})
+		defer close(progressStop)
+		go r.progress.Report(cfg.ProgressInterval, progressStop)
+	}
+	// 设置了查询预算时总是定期输出剩余的查询次数，关闭进度输出时按 budgetReportInterval 输出
+	if cfg.MaxLookups > 0 {
+		budgetStop := make(chan struct{})
+		defer close(budgetStop)
+		go r.budget.Report(cmp.Or(cfg.ProgressInterval, budgetReportInterval), budgetStop)
+	}
+	if cfg.ParallelismReport > 0 {
+		samplerStop := make(chan struct{})
+		defer close(samplerStop)
+		go r.profile.Sample(cfg.ParallelismReport, samplerStop)
+	}
+
+	// --- 2. 启动地址处理工作单元 (Smarty Workers) ---
+	// 新地址和退避结束的重试都通过 queue 分发给工作单元
+	queue := newRetryQueue(ctx, jobs, cfg.BatchSize)
+	scrapyWg.Add(cfg.SmartyWorkers)
+	for w := 1; w <= cfg.SmartyWorkers; w++ {
+		go func(w int) {
+			time.Sleep(r.rampDelay(w, cfg.SmartyWorkers))
+			r.smartyWorker(ctx, w, queue, results, failedJobs, &scrapyWg)
+		}(w)
+	}
+
+	// --- 3. 启动抓取工作单元 (ATMB Workers)，输入文件模式下改为直接推送输入地址 ---
+	producers := cfg.ATMBWorkers
+	if cfg.Addresses != nil {
+		producers = 1
+		atmbWg.Add(1)
+		go r.feedAddresses(cfg.Addresses, jobs, stop, &atmbWg)
+	} else {
+		atmbWg.Add(cfg.ATMBWorkers)
+		for w := 1; w <= cfg.ATMBWorkers; w++ {
+			go func(w int) {
+				time.Sleep(r.rampDelay(w, cfg.ATMBWorkers))
+				r.atmbWorker(ctx, w, stateChan, jobs, stop, &atmbWg)
+			}(w)
+		}
+	}
+
+	// --- 4. 分发抓取任务 ---
+	log.Println("正在分发州名给抓取工作单元...")
+	for _, state := range cfg.States {
+		stateChan <- state
+	}
+	close(stateChan)
+
+	// --- 5. 管理 Channel 关闭 (核心改动) ---
+	// 只有在所有抓取工作单元退出后才关闭 jobs，避免向已关闭的通道发送数据
+	go func() {
+		atmbWg.Wait()
+		log.Println("所有抓取工作单元已完成。关闭 jobs 通道，停止接收新任务。")
+		close(jobs)
+	}()
+
+	// 启动失败任务写入器。流式模式下每收到一条就立即写入文件，否则在结束时统一写入。
+	// 凭证耗尽由验证工作单元通过 r.shutdown 直接触发关闭，failedJobs 只负责记录失败的地址。
+	csvWriterWg.Add(1)
+	go func() {
+		defer csvWriterWg.Done()
+		if cfg.StreamFailed {
+			output.StreamFailedToCSV(cfg.FailedFile, failedJobs)
+			return
+		}
+		output.WriteFailedToCSV(cfg.FailedFile, failedJobs)
+	}()
+
+	// 启动结果写入器
+	// 所有验证成功的地址都计入结果统计，包括随后被 OnlyNonCMRA 丢弃的 CMRA 地址
+	resultStats := output.NewResultStats()
+	written := resultStats.Tap(results)
+	var cmraFilter *output.NonCMRAFilter
+	if cfg.OnlyNonCMRA {
+		// 只写入非 CMRA 地址，CMRA 地址在写入前被丢弃
+		cmraFilter = &output.NonCMRAFilter{Unknown: cfg.UnknownCMRA}
+		written = cmraFilter.Filter(written)
+	}
+	csvWriterWg.Add(1)
+	go func() {
+		defer csvWriterWg.Done()
+		if err := cfg.Writer.Write(written); err != nil {
+			log.Printf("错误: 写入结果失败: %v", err)
+		}
+	}()
+
+	// --- 6. 等待所有任务完成 ---
+	log.Println("正在等待所有地址处理工作单元完成...")
+	scrapyWg.Wait()
+	// 工作单元可能先于上面的 goroutine 发现 rootCtx 已经结束，这里补上对应的关闭原因，再固定 cause
+	if err := rootCtx.Err(); err != nil {
+		r.shutdown(contextCause(err))
+	}
+	close(watchDone)
+	<-watchExited
+	causeMu.Lock()
+	workersDone = true
+	causeMu.Unlock()
+	log.Println("所有地址处理工作单元已完成。关闭 results 通道。")
+	close(results)
+	close(failedJobs) // 在所有 processor 都退出后，关闭 failedJobs channel
+
+	// 等待CSV写入完成 (包括失败任务)
+	csvWriterWg.Wait()
+
+	// --- 7. 输出本次运行的统计 ---
+	if cmraFilter != nil {
+		log.Printf("-only-non-cmra: 已从结果中排除 %d 个 CMRA 地址 (CMRA 状态未知的地址: %s)。", cmraFilter.Dropped(), cfg.UnknownCMRA)
+	}
+	if skipped := r.seen.Skipped(); skipped > 0 {
+		log.Printf("推送验证任务前共跳过 %d 个重复的地址。", skipped)
+	}
+	resultStats.LogSummary()
+	r.progress.Log(r.profile.start)
+	r.metrics.LogSummary()
+	logStatusCodes()
+	if cfg.ParallelismReport > 0 {
+		r.profile.LogReport(producers, cfg.SmartyWorkers)
+	}
+	if latency := r.latency.Summary(); latency.Count > 0 {
+		log.Printf("Smarty 请求耗时: 共 %d 次，最小 %v，最大 %v，平均 %v，p50 %v，p95 %v",
+			latency.Count, latency.Min, latency.Max, latency.Avg, latency.P50, latency.P95)
+	}
+	if cfg.MaxLookups > 0 {
+		log.Printf("本次运行共使用 %d/%d 次 Smarty 查询。", r.budget.Used(), cfg.MaxLookups)
+	}
+
+	return Results{
+		Cause:           cause,
+		Progress:        r.progress.Snapshot(),
+		Stats:           resultStats,
+		StateCounts:     r.states.Counts(),
+		StateErrors:     r.states.Errors(),
+		Credentials:     apiManager.GetAllCredentials(),
+		CredentialsUsed: apiManager.UsedCredentials(),
+		Lookups:         r.budget.Used(),
+	}, nil
+}
+
+// rampDelay 返回第 w 个工作单元 (从 1 开始) 的启动延迟，
+// 使 n 个工作单元在 WorkerRamp 时间内均匀错开启动。
+func (r *runner) rampDelay(w, n int) time.Duration {
+	if r.cfg.WorkerRamp <= 0 || n <= 0 {
+		return 0
+	}
+	return r.cfg.WorkerRamp / time.Duration(n) * time.Duration(w-1)
+}
+
+// logStatusCodes 输出本次运行中抓取 ATMB 页面收到的 HTTP 状态码分布
+func logStatusCodes() {
+	counts := scrape.StatusCodeCounts()
+	if len(counts) == 0 {
+		return
+	}
+	parts := make([]string, len(counts))
+	for i, c := range counts {
+		parts[i] = fmt.Sprintf("%d: %d 次", c.Code, c.Count)
+	}
+	log.Printf("ATMB 页面 HTTP 状态码分布: %s", strings.Join(parts, ", "))
+}
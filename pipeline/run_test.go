@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"atmb/model"
+)
+
+// discardWriter 读完并丢弃所有结果
+type discardWriter struct{}
+
+func (discardWriter) Write(results <-chan *model.Address) error {
+	for range results {
+	}
+	return nil
+}
+
+// testRunConfig 返回以试运行模式验证 n 个输入地址的设置
+func testRunConfig(t *testing.T, n int) Config {
+	addrs := make([]*model.Address, n)
+	for i := range addrs {
+		addrs[i] = testWorkerAddress(fmt.Sprintf("%d Main St", i+1))
+	}
+	return Config{
+		Addresses:     addrs,
+		SmartyWorkers: 1,
+		DryRun:        true,
+		Writer:        discardWriter{},
+		FailedFile:    filepath.Join(t.TempDir(), "failed_results.csv"),
+	}
+}
+
+func TestRunCause(t *testing.T) {
+	expired, cancelExpired := context.WithDeadline(t.Context(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+	cancelled, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	for _, tt := range []struct {
+		name string
+		ctx  context.Context
+		want ShutdownCause
+	}{
+		{name: "正常完成", ctx: t.Context(), want: CauseCompleted},
+		{name: "到达期限", ctx: expired, want: CauseTimeout},
+		// 调用方取消 context 时放弃了剩余的工作，不能按正常完成处理
+		{name: "调用方取消", ctx: cancelled, want: CauseCancelled},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			run, err := Run(tt.ctx, testRunConfig(t, 3))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if run.Cause != tt.want {
+				t.Errorf("Cause = %s, want %s", run.Cause, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunCauseFixedAfterWorkersExit(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cfg := testRunConfig(t, 3)
+	// 写入结果期间才取消 context，此时所有地址都已处理完毕
+	cfg.Writer = writerFunc(func(results <-chan *model.Address) error {
+		discardWriter{}.Write(results)
+		cancel()
+		// 给 rootCtx 的监视 goroutine 留出时间，它不能再改变关闭原因
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	run, err := Run(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Cause != CauseCompleted {
+		t.Errorf("Cause = %s, want %s", run.Cause, CauseCompleted)
+	}
+}
+
+// writerFunc 把函数适配为 output.OutputWriter
+type writerFunc func(results <-chan *model.Address) error
+
+func (f writerFunc) Write(results <-chan *model.Address) error { return f(results) }
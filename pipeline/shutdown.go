@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ShutdownCause 记录触发关闭流程的原因，用于最终日志和退出码
+type ShutdownCause int
+
+const (
+	CauseCompleted            ShutdownCause = iota // 所有任务正常完成，没有触发关闭
+	CauseCredentialsExhausted                      // 所有 API 凭证均已耗尽
+	CauseBudgetExhausted                           // 查询次数达到 -max-lookups 上限
+	CauseFatalError                                // 重试策略判定为致命错误
+	CauseSignal                                    // 收到 SIGINT/SIGTERM
+	CauseTimeout                                   // 达到 -timeout 运行期限
+	CauseCancelled                                 // 调用方取消了 Run 的 context
+)
+
+func (c ShutdownCause) String() string {
+	switch c {
+	case CauseCompleted:
+		return "全部完成"
+	case CauseCredentialsExhausted:
+		return "凭证耗尽"
+	case CauseBudgetExhausted:
+		return "查询预算耗尽"
+	case CauseFatalError:
+		return "致命错误"
+	case CauseSignal:
+		return "收到中断信号"
+	case CauseTimeout:
+		return "达到运行期限"
+	case CauseCancelled:
+		return "运行被取消"
+	}
+	return "未知原因"
+}
+
+// ExitCode 返回该原因对应的进程退出码，正常完成时为 0
+func (c ShutdownCause) ExitCode() int {
+	switch c {
+	case CauseCompleted:
+		return 0
+	case CauseCredentialsExhausted:
+		return 3
+	case CauseBudgetExhausted:
+		return 4
+	case CauseFatalError:
+		return 5
+	case CauseSignal:
+		return 130 // 与 shell 中被 SIGINT 终止的约定一致
+	case CauseTimeout:
+		return 6
+	case CauseCancelled:
+		return 7
+	}
+	return 1
+}
+
+// forceExitWindow 是第一次收到中断信号后，再次收到信号即强制退出的时间窗口
+const forceExitWindow = 5 * time.Second
+
+// contextCause 返回 Run 的 context 结束 (err 为其 Err()) 时对应的关闭原因：到达期限为超时，否则为被调用方取消
+func contextCause(err error) ShutdownCause {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CauseTimeout
+	}
+	return CauseCancelled
+}
+
+// handleSignals 在收到 SIGINT/SIGTERM 时通过 shutdown 触发与凭证耗尽相同的关闭流程：
+// 抓取工作单元停止推送，jobs 在它们退出后正常关闭，已完成的结果仍会写入文件。
+// 第一次信号后 forceExitWindow 内再次收到信号时立即退出，不再等待。
+// 返回的 stop 取消信号处理并等待处理信号的 goroutine 退出，之后的信号恢复默认行为。
+func handleSignals(shutdown func(ShutdownCause)) (stop func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		var last time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				if !last.IsZero() && time.Since(last) <= forceExitWindow {
+					log.Printf("再次收到信号 %v，强制退出，尚未写入的结果将丢失。", sig)
+					os.Exit(CauseSignal.ExitCode())
+				}
+				last = time.Now()
+				log.Printf("收到信号 %v，正在停止并写入已完成的结果。%v 内再次发送信号将强制退出。", sig, forceExitWindow)
+				shutdown(CauseSignal)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+		<-exited
+	}
+}
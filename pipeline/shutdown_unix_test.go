@@ -0,0 +1,43 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignalsStop(t *testing.T) {
+	called := make(chan ShutdownCause, 1)
+	stop := handleSignals(func(c ShutdownCause) { called <- c })
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case c := <-called:
+		if c != CauseSignal {
+			t.Errorf("shutdown(%s)，want %s", c, CauseSignal)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("收到 SIGTERM 后没有触发关闭流程")
+	}
+	stop()
+
+	// stop 之后的信号不再交给已经结束的运行；这里用另一个通道接收，避免测试进程被终止
+	other := make(chan os.Signal, 1)
+	signal.Notify(other, syscall.SIGTERM)
+	defer signal.Stop(other)
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	<-other
+	select {
+	case c := <-called:
+		t.Errorf("stop 之后仍然触发了 shutdown(%s)", c)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"atmb/credential"
+	"atmb/model"
+	"atmb/verify"
+
+	"github.com/smartystreets/smartystreets-go-sdk/wireup"
+)
+
+// smartyOptions 返回使用指定凭证构建 Smarty 客户端所需的 wireup 选项
+func (r *runner) smartyOptions(cred credential.ApiCredential) []wireup.Option {
+	options := []wireup.Option{wireup.SecretKeyCredential(cred.AuthID, cred.AuthToken)}
+	if r.cfg.HTTPClient != nil {
+		options = append(options, wireup.WithHTTPClient(r.cfg.HTTPClient))
+	}
+	if r.cfg.SDKMaxRetry >= 0 {
+		options = append(options, wireup.MaxRetry(r.cfg.SDKMaxRetry))
+	}
+	return options
+}
+
+// checkCredential 使用凭证验证一个固定的测试地址，用于在启动时发现填错的凭证。
+// 每次检查消耗该凭证的一次查询；地址本身能否验证不影响结果，只有认证失败才视为凭证无效。
+func (r *runner) checkCredential(ctx context.Context, cred credential.ApiCredential) error {
+	client := wireup.BuildUSStreetAPIClient(r.smartyOptions(cred)...)
+	addr := &model.Address{Street: "1 Rosedale", City: "Baltimore", State: "MD", Zip: "21229"}
+	err := verify.SmartyVerifier{Client: client, BatchTimeout: r.cfg.BatchTimeout}.Verify(ctx, addr)
+	if err == nil || errors.Is(err, verify.ErrUnknownAddress) {
+		return nil
+	}
+	if errors.Is(err, verify.ErrAuthentication) {
+		return fmt.Errorf("%w: %v", credential.ErrInvalidCredential, err)
+	}
+	return err
+}
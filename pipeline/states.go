@@ -0,0 +1,79 @@
+package pipeline
+
+import (
+	"maps"
+	"sort"
+	"sync"
+)
+
+// StateThreshold 描述每个州至少应抓取到的地址数量，用于发现不完整的抓取
+type StateThreshold struct {
+	// Min 是全局最低数量，0 表示不检查；PerState 按州 slug 指定最低数量，优先于 Min
+	Min      int
+	PerState map[string]int
+	// Requeue 是数量不足时重新抓取该州的次数
+	Requeue int
+}
+
+// expected 返回州的最低地址数量，0 表示不检查
+func (t StateThreshold) expected(state string) int {
+	if n, ok := t.PerState[state]; ok {
+		return n
+	}
+	return t.Min
+}
+
+// isShort 判断抓取到的地址数量是否低于该州的最低数量
+func (t StateThreshold) isShort(state string, count int) bool {
+	return count < t.expected(state)
+}
+
+// StateError 是一个抓取失败、被跳过的州及其错误
+type StateError struct {
+	State string `json:"state"`
+	Error string `json:"error"`
+}
+
+// stateLog 记录每个州实际抓取到的地址数量，以及抓取失败、被跳过的州，可被多个抓取工作单元并发使用
+type stateLog struct {
+	mu     sync.Mutex
+	counts map[string]int
+	errors map[string]string
+}
+
+func newStateLog() *stateLog {
+	return &stateLog{counts: map[string]int{}, errors: map[string]string{}}
+}
+
+// RecordCount 记录某个州抓取到的地址数量
+func (l *stateLog) RecordCount(state string, n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.counts[state] = n
+}
+
+// RecordError 记录某个州抓取失败的原因
+func (l *stateLog) RecordError(state string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors[state] = err.Error()
+}
+
+// Counts 返回各州抓取到的地址数量的副本
+func (l *stateLog) Counts() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return maps.Clone(l.counts)
+}
+
+// Errors 按州名排序返回所有抓取失败的州
+func (l *stateLog) Errors() []StateError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := make([]StateError, 0, len(l.errors))
+	for state, err := range l.errors {
+		list = append(list, StateError{State: state, Error: err})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].State < list[j].State })
+	return list
+}
@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"atmb/scrape"
+)
+
+// statusResponse 是 /status 返回的 JSON
+type statusResponse struct {
+	Progress
+	// CredentialsRemaining 是尚有剩余额度的凭证数量，CurrentCredential 和 CurrentUsage 是当前凭证的序号 (从 0 开始) 及已使用次数
+	CredentialsRemaining int `json:"credentials_remaining"`
+	CurrentCredential    int `json:"current_credential"`
+	CurrentUsage         int `json:"current_credential_usage"`
+	// ElapsedSeconds 是从开始抓取到现在经过的秒数
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// startStatusServer 在 addr 上启动状态服务，提供存活和就绪检查以及运行进度：
+//   - /healthz: 进程存活即返回 200
+//   - /readyz:  至少有一组凭证尚有剩余额度，且最近一次抓取成功时返回 200，否则返回 503
+//   - /status:  以 JSON 返回与进度日志相同的计数，以及凭证的使用情况
+//   - /metrics: 以 Prometheus 文本格式导出地址计数、Smarty 查询结果和请求耗时直方图
+//
+// 返回的函数用于在关闭流程中停止服务。
+func (r *runner) startStatusServer(addr string) func() {
+	apiManager := r.apiManager
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if apiManager.RemainingCredentials() == 0 {
+			http.Error(w, "no credential with remaining quota", http.StatusServiceUnavailable)
+			return
+		}
+		if !scrape.LastFetchSucceeded() {
+			http.Error(w, "last scrape failed", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready\n"))
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		resp := statusResponse{
+			Progress:             r.progress.Snapshot(),
+			CredentialsRemaining: apiManager.RemainingCredentials(),
+		}
+		resp.CurrentCredential, resp.CurrentUsage = apiManager.CurrentCredential()
+		resp.ElapsedSeconds = time.Since(r.profile.start).Round(time.Second).Seconds()
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("警告: 写入 /status 响应失败: %v", err)
+		}
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.writeMetrics(w)
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		log.Printf("状态服务已启动: http://%s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("警告: 状态服务异常退出: %v", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("警告: 关闭状态服务失败: %v", err)
+		}
+	}
+}
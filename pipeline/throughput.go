@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// stageProfiler 统计抓取阶段 (ATMB) 和验证阶段 (Smarty) 的吞吐量和空闲时间，
+// 用于判断哪个阶段是瓶颈，从而调整两类工作单元的数量。
+type stageProfiler struct {
+	start time.Time
+
+	produced atomic.Int64 // ATMB 工作单元推送到 jobs 的地址数
+	consumed atomic.Int64 // Smarty 工作单元处理完成的地址数
+
+	// atmbBlocked 是 ATMB 工作单元因 jobs 已满而阻塞的总时间 (验证阶段跟不上)
+	atmbBlocked atomic.Int64
+	// smartyIdle 是 Smarty 工作单元等待新任务的总时间 (抓取阶段跟不上)
+	smartyIdle atomic.Int64
+}
+
+func (p *stageProfiler) Produced()                   { p.produced.Add(1) }
+func (p *stageProfiler) Consumed()                   { p.consumed.Add(1) }
+func (p *stageProfiler) ATMBBlocked(d time.Duration) { p.atmbBlocked.Add(int64(d)) }
+func (p *stageProfiler) SmartyIdle(d time.Duration)  { p.smartyIdle.Add(int64(d)) }
+func (p *stageProfiler) counts() (produced, consumed int64) {
+	return p.produced.Load(), p.consumed.Load()
+}
+
+// Sample 每隔 interval 记录一次两个阶段在该时间段内的速率，直到 stop 被关闭
+func (p *stageProfiler) Sample(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	lastProduced, lastConsumed := p.counts()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			produced, consumed := p.counts()
+			seconds := interval.Seconds()
+			log.Printf("[吞吐量] 抓取 %.2f 个/秒，验证 %.2f 个/秒，队列积压 %d 个",
+				float64(produced-lastProduced)/seconds, float64(consumed-lastConsumed)/seconds, produced-consumed)
+			lastProduced, lastConsumed = produced, consumed
+		}
+	}
+}
+
+// LogReport 输出两个阶段整体的吞吐量和空闲比例。
+// 空闲比例 = 该阶段所有工作单元的空闲时间之和 / (工作单元数 × 运行时长)。
+func (p *stageProfiler) LogReport(atmbWorkers, smartyWorkers int) {
+	elapsed := time.Since(p.start)
+	produced, consumed := p.counts()
+	atmbBlocked := time.Duration(p.atmbBlocked.Load())
+	smartyIdle := time.Duration(p.smartyIdle.Load())
+
+	ratio := func(idle time.Duration, workers int) float64 {
+		if workers <= 0 || elapsed <= 0 {
+			return 0
+		}
+		return 100 * idle.Seconds() / (float64(workers) * elapsed.Seconds())
+	}
+
+	log.Printf("阶段吞吐量报告 (运行 %v):", elapsed.Round(time.Second))
+	log.Printf("  抓取 (ATMB x%d):    共 %d 个，%.2f 个/秒，因队列已满阻塞 %v (%.1f%%)",
+		atmbWorkers, produced, float64(produced)/elapsed.Seconds(), atmbBlocked.Round(time.Millisecond), ratio(atmbBlocked, atmbWorkers))
+	log.Printf("  验证 (Smarty x%d): 共 %d 个，%.2f 个/秒，等待任务空闲 %v (%.1f%%)",
+		smartyWorkers, consumed, float64(consumed)/elapsed.Seconds(), smartyIdle.Round(time.Millisecond), ratio(smartyIdle, smartyWorkers))
+	switch {
+	case ratio(atmbBlocked, atmbWorkers) > ratio(smartyIdle, smartyWorkers):
+		log.Println("  验证阶段是瓶颈，可以考虑增加 Smarty 工作单元。")
+	case ratio(smartyIdle, smartyWorkers) > ratio(atmbBlocked, atmbWorkers):
+		log.Println("  抓取阶段是瓶颈，可以考虑增加 ATMB 工作单元。")
+	}
+}
@@ -0,0 +1,448 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"atmb/credential"
+	"atmb/model"
+	"atmb/scrape"
+	"atmb/verify"
+
+	"github.com/smartystreets/smartystreets-go-sdk/wireup"
+)
+
+// 重试相关的默认设置，也是 -max-retries、-initial-backoff 和 -max-backoff 参数的默认值
+const (
+	DefaultMaxRetries     = 4                // 最大重试次数 (默认总共会尝试 1 + 4 = 5次)
+	DefaultInitialBackoff = 2 * time.Second  // 初始退避时间
+	DefaultMaxBackoff     = 60 * time.Second // 单次退避时间的上限
+)
+
+// backoffJitter 是退避时间的随机浮动比例 (±20%)，避免多个工作单元在同一时刻集中重试
+const backoffJitter = 0.2
+
+// maxStateAttempts 是州页面无法解析、被站点拦截或分页抓取不完整 (fail-state 模式) 时重新抓取整个州的最大次数
+const maxStateAttempts = 2
+
+// blockedBackoff 是州页面被站点拦截后第一次重新抓取前的等待时间，之后每次递增
+const blockedBackoff = 30 * time.Second
+
+// retryBackoff 返回第 attempt 次失败 (从 1 开始) 后的退避时间：
+// InitialBackoff * 2^(attempt-1)，不超过 MaxBackoff，再加上 ±backoffJitter 的随机浮动
+func (r *runner) retryBackoff(attempt int) time.Duration {
+	initialBackoff, maxBackoff := r.cfg.InitialBackoff, r.cfg.MaxBackoff
+	backoff := maxBackoff
+	// 超过 62 位时左移会溢出，此时必然已经超过上限
+	if shift := attempt - 1; shift < 62 && initialBackoff < maxBackoff>>shift {
+		backoff = initialBackoff << shift
+	}
+	jitter := 1 + backoffJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(backoff) * jitter)
+}
+
+// 失败任务的原因
+const (
+	reasonCredentialsExhausted = "credentials exhausted"
+	reasonBudgetExhausted      = "budget exhausted"
+	reasonUnknownAddress       = "unknown address"
+	reasonReplayFailed         = "replay failed"
+	reasonVerifyFailed         = "verification failed"
+	reasonCancelled            = "cancelled"
+)
+
+// smartyWorker 是smarty工作单元，现在包含了指数退避重试逻辑。
+// 工作单元每次从 queue 取出已就绪的任务 (最多 BatchSize 个)，合并为一次批量请求验证。
+// 需要重试的地址交给 queue 在退避结束后重新分发，工作单元在此期间继续处理其他地址。
+// 验证失败后的处理方式由 RetryPolicy 决定。
+// 凭证耗尽或查询总次数达到 MaxLookups 上限后，剩余的地址都会被直接发送到 failedJobs，并通过 r.shutdown 触发关闭流程。
+// ctx 被取消 (程序关闭) 后，正在进行的请求会被中止，剩余的地址都以 cancelled 原因发送到 failedJobs。
+// DryRun 模式下不调用 Smarty，所有地址都直接发送到 results。
+func (r *runner) smartyWorker(ctx context.Context, id int, queue *retryQueue, results chan<- *model.Address, failedJobs chan<- *model.Address, wg *sync.WaitGroup) {
+	defer wg.Done()
+	cfg, apiManager, metrics, budget := r.cfg, r.apiManager, r.metrics, r.budget
+
+	// exhausted 标记凭证已耗尽，之后的地址不再请求凭证，直接记为失败
+	exhausted := false
+	// perAddress 是验证一个地址最多需要的查询次数，MatchChain 中的每个策略都是一次独立的查询
+	perAddress := verify.SmartyVerifier{MatchChain: cfg.MatchChain}.LookupsPerAddress()
+
+	// finish 在地址处理完毕 (成功或最终失败) 时调用，不再重试
+	// ok 表示地址已写入结果，用于统计进度
+	finish := func(ok bool) {
+		r.progress.Finished(ok)
+		r.profile.Consumed()
+		queue.Done()
+	}
+	// fail 记录最终失败的地址并发送到 failedJobs
+	fail := func(job *retryJob, reason string) {
+		metrics.RecordOutcome(job.categories, false)
+		job.addr.FailReason = reason
+		failedJobs <- job.addr
+		finish(false)
+	}
+
+	for {
+		// 记录等待新任务的时间，用于判断抓取阶段是否跟得上
+		waitStart := time.Now()
+		first, ok := <-queue.work
+		r.profile.SmartyIdle(time.Since(waitStart))
+		if !ok {
+			return
+		}
+
+		// 1. 逐个检查批次中的地址，需要发送给 Smarty 的地址留在 pending 中
+		var pending []*retryJob
+		for _, job := range queue.nextBatch(first, cfg.BatchSize) {
+			addr := job.addr
+			// 该地址后续的日志都附带它的关联 ID
+			ctx := jobContext(ctx, id, job)
+			if job.attempt == 0 {
+				// 清理地址字段后再做缓存、检查点和回放的查找，使它们与发送给 Smarty 的地址一致
+				r.normalizeAddress(ctx, addr)
+				logJob(ctx, "[Scrapy %d] 正在处理地址: %s, %s", id, addr.Street, addr.City)
+			} else {
+				logJob(ctx, "[Scrapy %d] 正在重试地址 (第 %d 次重试): %s, %s", id, job.attempt, addr.Street, addr.City)
+			}
+
+			// 试运行模式不调用 Smarty，CMRA/RDI 保持 UNKNOWN，地址直接写入结果
+			if cfg.DryRun {
+				logJob(ctx, "[Scrapy %d] 试运行模式，跳过验证: %s, %s", id, addr.Street, addr.City)
+				results <- addr
+				finish(true)
+				continue
+			}
+
+			// 地点卡片内容与上次运行相同时直接复用上次的验证结果
+			if job.attempt == 0 && cfg.HashCache != nil && cfg.HashCache.Reuse(addr) {
+				logJob(ctx, "[Scrapy %d] 地点内容未变化，复用上次的验证结果: %s, %s", id, addr.Street, addr.City)
+				r.recordCheckpoint(ctx, addr)
+				results <- addr
+				finish(true)
+				continue
+			}
+
+			// 上次运行中断前已经验证过的地址，直接复用检查点中的验证结果
+			if job.attempt == 0 && cfg.Checkpoint != nil && cfg.Checkpoint.Resume(addr) {
+				logJob(ctx, "[Scrapy %d] 检查点中已有该地址，跳过验证: %s, %s", id, addr.Street, addr.City)
+				// 追加结果时上次运行已经把该地址写入结果文件，只计入进度，不再重复写入
+				if !cfg.AppendResults {
+					results <- addr
+				}
+				finish(true)
+				continue
+			}
+
+			// 回放模式下直接读取已保存的响应，无需凭证，也无需重试
+			if cfg.ReplayDir != "" {
+				replay := verify.ReplayVerifier{Dir: cfg.ReplayDir}
+				err := replay.Verify(ctx, addr)
+				if err != nil {
+					logJobErr(ctx, err, "[Scrapy %d] 回放地址失败: %s, %s: %v", id, addr.Street, addr.City, err)
+					addr.FailReason = reasonReplayFailed
+					failedJobs <- addr
+				} else {
+					results <- addr
+				}
+				finish(err == nil)
+				continue
+			}
+
+			// 程序正在关闭，不再发起新的请求
+			if ctx.Err() != nil {
+				logJob(ctx, "[Scrapy %d] 程序正在关闭，放弃地址: %s, %s", id, addr.Street, addr.City)
+				fail(job, reasonCancelled)
+				continue
+			}
+
+			// 检查查询预算，按匹配策略的数量为每个地址预留查询次数，请求结束后归还没有用到的部分
+			if !budget.TakeN(int64(perAddress)) {
+				logJob(ctx, "[Scrapy %d] 查询次数已达到预算上限 (%d)，不再验证地址: %s, %s", id, budget.limit, addr.Street, addr.City)
+				fail(job, reasonBudgetExhausted)
+				r.shutdown(CauseBudgetExhausted)
+				continue
+			}
+			pending = append(pending, job)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		for len(pending) > 0 {
+			// 2. 为批次获取一个凭证，与查询预算一样按每个地址最多的查询次数预留凭证额度。
+			// 凭证的剩余额度容纳不下整个批次时只发送其中一部分，其余的地址在下一轮使用下一个凭证
+			var cred credential.ApiCredential
+			granted := len(pending)
+			if !exhausted {
+				var ok bool
+				if cred, granted, ok = apiManager.GetCredentials(len(pending), perAddress); !ok {
+					exhausted = true
+					// 只有凭证耗尽才以该原因触发关闭，地址未知等普通失败只写入失败任务文件
+					logJob(ctx, "[Scrapy %d] 检测到凭证耗尽。", id)
+					r.shutdown(CauseCredentialsExhausted)
+				}
+			}
+			if exhausted {
+				// 这些地址没有发送给 Smarty，归还为它们占用的查询预算，run_report.json 中的查询次数不会虚高
+				budget.Release(int64(len(pending) * perAddress))
+				for _, job := range pending {
+					logJob(jobContext(ctx, id, job), "[Scrapy %d] 所有API凭证均已失效，放弃地址: %s, %s", id, job.addr.Street, job.addr.City)
+					// 将无法处理的地址发送到 failedJobs channel
+					fail(job, reasonCredentialsExhausted)
+				}
+				break
+			}
+			batch := pending[:granted]
+			pending = pending[granted:]
+			reserved := len(batch) * perAddress
+
+			// 3. 发起批量请求
+			addrs := make([]*model.Address, len(batch))
+			for i, job := range batch {
+				addrs[i] = job.addr
+			}
+			client := wireup.BuildUSStreetAPIClient(r.smartyOptions(cred)...)
+			verifier := verify.SmartyVerifier{
+				Client:        client,
+				RecordDir:     cfg.RecordDir,
+				Latency:       r.latency,
+				SlowThreshold: cfg.SlowThreshold,
+				MatchChain:    cfg.MatchChain,
+				MaxCandidates: cfg.MaxCandidates,
+				BatchTimeout:  cfg.BatchTimeout,
+			}
+			errs, lookups := verifier.VerifyBatchLookups(ctx, addrs)
+			// 前面的匹配策略已经验证成功的地址不会发送后续策略的查询，归还为它们预留的额度
+			budget.Release(int64(reserved - lookups))
+			apiManager.Release(cred, reserved-lookups)
+
+			// 4. 逐个处理结果。同一批次的请求失败通常是同一个原因，凭证最多只标记失效一次
+			rotated := false
+			for i, job := range batch {
+				addr, err := job.addr, errs[i]
+				ctx := jobContext(ctx, id, job)
+				r.smartyResults.Record(err)
+				if err == nil {
+					// 成功！将结果发送
+					metrics.RecordOutcome(job.categories, true)
+					if cfg.HashCache != nil {
+						cfg.HashCache.Store(addr)
+					}
+					r.recordCheckpoint(ctx, addr)
+					results <- addr
+					finish(true)
+					continue
+				}
+
+				// 根据重试策略决定下一步
+				category := verify.Classify(err)
+				action := cfg.RetryPolicy.Classify(err)
+				if action == verify.Fail || action == verify.Fatal {
+					reason := reasonVerifyFailed + ": " + string(category)
+					if errors.Is(err, context.Canceled) {
+						logJob(ctx, "[Scrapy %d] 请求因程序关闭被取消: %s, %s", id, addr.Street, addr.City)
+						reason = reasonCancelled
+					} else if errors.Is(err, verify.ErrUnknownAddress) {
+						// 如果是 "地址未知" 错误，则无需重试，直接放弃这个地址，但做记录
+						logJob(ctx, "[Scrapy %d] 地址未知，无需重试: %s, %s", id, addr.Street, addr.City)
+						if cfg.AutocompleteFallback {
+							r.suggestAddress(ctx, id, cred, addr)
+						}
+						reason = reasonUnknownAddress
+					} else {
+						logJobErr(ctx, err, "[Scrapy %d] 重试策略判定放弃地址 %s, %s (类别 %s): %v", id, addr.Street, addr.City, category, err)
+					}
+					fail(job, reason)
+					if action == verify.Fatal {
+						logJob(ctx, "[Scrapy %d] 重试策略判定为致命错误，触发关闭流程。", id)
+						r.shutdown(CauseFatalError)
+					}
+					continue
+				}
+
+				// 对于需要重试的错误，记录日志，按策略决定是否标记凭证失效，然后交给重试队列
+				job.categories[category] = true
+				job.attempt++
+				logJobErr(withLogAttrs(ctx, slog.String("category", string(category)), slog.String("action", action.String())), err,
+					"[Scrapy %d] 使用凭证 %s 失败 (尝试 %d/%d, 类别 %s, 动作 %s): %v", id, cred.AuthID, job.attempt, cfg.MaxRetries+1, category, action, err)
+				if action == verify.RotateCredential && !rotated {
+					apiManager.InvalidateCurrent()
+					rotated = true
+				}
+				if job.attempt > cfg.MaxRetries {
+					// 所有重试都失败了，记录一条最终的放弃日志，地址写入失败任务文件
+					logJob(ctx, "[Scrapy %d] 所有重试均失败，放弃地址: %s, %s", id, addr.Street, addr.City)
+					fail(job, reasonVerifyFailed+": "+string(category))
+					continue
+				}
+				metrics.RecordRetry(category)
+				// 计算本次重试的等待时间 (约 2s, 4s, 8s...，不超过 maxBackoff)
+				backoffDuration := r.retryBackoff(job.attempt)
+				logJob(ctx, "[Scrapy %d] 第 %d 次尝试失败。将在 %v 后重试...", id, job.attempt, backoffDuration)
+				queue.Retry(job, backoffDuration)
+			}
+			// 只统计实际发送过查询、且没有因认证失败被标记失效的凭证
+			if lookups > 0 && !rotated {
+				apiManager.MarkUsed(cred)
+			}
+		}
+	}
+}
+
+// recordCheckpoint 将验证成功的地址写入检查点 (如已开启)，写入失败只记录日志
+func (r *runner) recordCheckpoint(ctx context.Context, addr *model.Address) {
+	if r.cfg.Checkpoint == nil {
+		return
+	}
+	if err := r.cfg.Checkpoint.Record(addr); err != nil {
+		logJobErr(ctx, err, "警告: %v", err)
+	}
+}
+
+// suggestAddress 为无法验证的地址查询 Autocomplete 建议并保存到 addr.Suggestion。
+// 建议查询同样占用查询预算，预算不足或查询失败时只记录日志。
+func (r *runner) suggestAddress(ctx context.Context, id int, cred credential.ApiCredential, addr *model.Address) {
+	if !r.budget.Take() {
+		logJob(ctx, "[Scrapy %d] 查询预算已用完，跳过地址建议查询: %s, %s", id, addr.Street, addr.City)
+		return
+	}
+	client := wireup.BuildUSAutocompleteProAPIClient(r.smartyOptions(cred)...)
+	suggestion, err := verify.Suggest(ctx, client, addr)
+	if err != nil {
+		logJobErr(ctx, err, "[Scrapy %d] 查询地址建议失败: %s, %s: %v", id, addr.Street, addr.City, err)
+		return
+	}
+	if suggestion == "" {
+		logJob(ctx, "[Scrapy %d] 没有找到地址建议: %s, %s", id, addr.Street, addr.City)
+		return
+	}
+	addr.Suggestion = suggestion
+	logJob(ctx, "[Scrapy %d] 地址 %s, %s 的建议写法: %s", id, addr.Street, addr.City, suggestion)
+}
+
+// atmbWorker 是 ATMB 抓取具体州地址的工作单位。
+// stop 被关闭后停止抓取和推送，jobs 通道由调用方在所有抓取工作单元退出后关闭。
+// 某个州抓取到的地址少于 Threshold 规定的数量时会发出警告，并按配置重新抓取。
+func (r *runner) atmbWorker(ctx context.Context, id int, stateChan <-chan string, jobs chan<- *model.Address, stop <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	threshold := r.cfg.Threshold
+
+	for state := range stateChan {
+		select {
+		case <-stop:
+			log.Printf("[ATMB %d] 收到关闭信号，停止抓取。", id)
+			return
+		case <-ctx.Done():
+			log.Printf("[ATMB %d] 运行已取消或超时，停止抓取。", id)
+			return
+		default:
+		}
+
+		// 该州的日志都附带工作单元编号和州名 (JSON 日志格式下输出为字段)
+		ctx := withLogAttrs(ctx, slog.Int("worker", id), slog.String("state", state))
+		logJob(ctx, "[ATMB %d] 正在抓取州: %s", id, state)
+
+		addresses, err := scrape.GetStateDetail(ctx, state)
+		// 页面无法解析，或 fail-state 模式下分页中途失败丢弃了整个州时，重新抓取整个州
+		// 被站点拦截时先退避一段时间，避免立即重试加重限流
+		for attempt := 1; scrape.Retryable(err) && attempt <= maxStateAttempts; attempt++ {
+			if errors.Is(err, scrape.ErrBlocked) {
+				wait := blockedBackoff * time.Duration(attempt)
+				logJobErr(ctx, err, "[ATMB %d] %s 的请求被站点拦截 (%v)，%v 后重新抓取 (%d/%d)...", id, state, err, wait, attempt, maxStateAttempts)
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					break
+				}
+			} else {
+				logJobErr(ctx, err, "[ATMB %d] %s 抓取不完整 (%v)，正在重新抓取整个州 (%d/%d)...", id, state, err, attempt, maxStateAttempts)
+			}
+			addresses, err = scrape.GetStateDetail(ctx, state)
+		}
+		if ctx.Err() != nil {
+			logJob(ctx, "[ATMB %d] 运行已取消或超时，放弃抓取 %s。", id, state)
+			return
+		}
+		if err != nil {
+			if errors.Is(err, scrape.ErrBlocked) {
+				logJobErr(ctx, err, "[ATMB %d] !!警告!! %s 的请求持续被站点拦截，跳过该州 (不会记录为没有地址): %v。可以降低 -atmb-rps 或更换 -user-agent 后重新抓取。", id, state, err)
+				r.states.RecordError(state, err)
+				continue
+			}
+			logJobErr(ctx, err, "[ATMB %d] 抓取 %s 失败，跳过该州: %v", id, state, err)
+			r.states.RecordError(state, err)
+			continue
+		}
+		for retry := 1; threshold.isShort(state, len(addresses)); retry++ {
+			logJob(ctx, "[ATMB %d] !!警告!! %s 只抓取到 %d 个地址，低于预期的 %d 个，抓取可能不完整。", id, state, len(addresses), threshold.expected(state))
+			if retry > threshold.Requeue || ctx.Err() != nil {
+				break
+			}
+			logJob(ctx, "[ATMB %d] 正在重新抓取 %s (%d/%d)...", id, state, retry, threshold.Requeue)
+			// 保留地址数量最多的一次结果
+			if again, err := scrape.GetStateDetail(ctx, state); err == nil && len(again) > len(addresses) {
+				addresses = again
+			}
+		}
+
+		if r.cfg.AvailableOnly {
+			addresses = filterAvailable(id, state, addresses)
+		}
+
+		r.states.RecordCount(state, len(addresses))
+		r.progress.StateDone()
+		logJob(ctx, "[ATMB %d] 在 %s 找到 %d 个地址，正在推送到处理队列...", id, state, len(addresses))
+
+		pushed := 0
+		for i := range addresses {
+			// 抽样运行时每个州只按页面顺序推送前 SamplePerState 个 (不重复的) 地址
+			if r.cfg.SamplePerState > 0 && pushed >= r.cfg.SamplePerState {
+				logJob(ctx, "[ATMB %d] -sample-per-state: %s 已推送 %d 个地址，跳过其余 %d 个。", id, state, pushed, len(addresses)-i)
+				break
+			}
+			addresses[i].ID = newJobID(state, i)
+			// 同一地址已经由其他州 (或同一州的重复卡片) 推送过时不再验证
+			if !r.seen.FirstSeen(&addresses[i]) {
+				logJob(withJobID(ctx, addresses[i].ID), "[ATMB %d] 跳过重复的地址: %s, %s, %s %s", id, addresses[i].Street, addresses[i].City, addresses[i].State, addresses[i].Zip)
+				continue
+			}
+			// 记录因 jobs 已满而阻塞的时间，用于判断验证阶段是否跟得上
+			sendStart := time.Now()
+			select {
+			case jobs <- &addresses[i]:
+				r.profile.ATMBBlocked(time.Since(sendStart))
+				r.profile.Produced()
+				r.progress.Discovered()
+				pushed++
+			case <-stop:
+				logJob(ctx, "[ATMB %d] 收到关闭信号，停止推送 %s 的剩余地址。", id, state)
+				return
+			case <-ctx.Done():
+				logJob(ctx, "[ATMB %d] 运行已取消或超时，停止推送 %s 的剩余地址。", id, state)
+				return
+			}
+		}
+	}
+	log.Printf("[ATMB %d] 已完成所有任务，正在退出。", id)
+}
+
+// filterAvailable 移除尚未开业 (coming soon) 的地点
+func filterAvailable(id int, state string, addresses []model.Address) []model.Address {
+	available := addresses[:0]
+	for _, addr := range addresses {
+		if addr.Available() {
+			available = append(available, addr)
+		}
+	}
+	if removed := len(addresses) - len(available); removed > 0 {
+		log.Printf("[ATMB %d] %s 中有 %d 个地点尚未开业，已跳过。", id, state, removed)
+	}
+	return available
+}
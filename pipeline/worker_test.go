@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"atmb/credential"
+	"atmb/model"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+)
+
+// runWorker 用 r 的一个验证工作单元处理 addrs，返回写入结果和失败任务的地址
+func runWorker(t *testing.T, r *runner, addrs ...*model.Address) (results, failed []*model.Address) {
+	t.Helper()
+	ctx := t.Context()
+	jobs := make(chan *model.Address, len(addrs))
+	for _, addr := range addrs {
+		jobs <- addr
+	}
+	close(jobs)
+
+	resultsCh := make(chan *model.Address, len(addrs))
+	failedCh := make(chan *model.Address, len(addrs))
+	queue := newRetryQueue(ctx, jobs, len(addrs))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	r.smartyWorker(ctx, 1, queue, resultsCh, failedCh, &wg)
+	close(resultsCh)
+	close(failedCh)
+	for addr := range resultsCh {
+		results = append(results, addr)
+	}
+	for addr := range failedCh {
+		failed = append(failed, addr)
+	}
+	return results, failed
+}
+
+func TestWorkerResumeWithAppend(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		appendCSV   bool
+		wantResults int
+	}{
+		{name: "覆盖结果文件时重新写入恢复的地址", appendCSV: false, wantResults: 1},
+		{name: "追加结果文件时不重复写入恢复的地址", appendCSV: true, wantResults: 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cp, err := OpenCheckpoint(filepath.Join(t.TempDir(), "processed.jsonl"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { cp.Close() })
+			done := &model.Address{Street: "1 Main St", City: "Austin", State: "TX", Zip: "78701", Link: "https://example.com/1", CMRA: "N", RDI: "Commercial"}
+			if err := cp.Record(done); err != nil {
+				t.Fatal(err)
+			}
+			r := newRunner(Config{Checkpoint: cp, AppendResults: tt.appendCSV})
+
+			addr := &model.Address{Street: "1 Main St", City: "Austin", State: "TX", Zip: "78701", Link: done.Link, CMRA: "UNKNOWN"}
+			results, failed := runWorker(t, r, addr)
+
+			if len(results) != tt.wantResults || len(failed) != 0 {
+				t.Fatalf("results = %d, failed = %d，want %d, 0", len(results), len(failed), tt.wantResults)
+			}
+			if addr.CMRA != "N" {
+				t.Errorf("CMRA = %q，want 检查点中的 N", addr.CMRA)
+			}
+			if got := r.progress.Snapshot().Verified; got != 1 {
+				t.Errorf("恢复的地址应计入进度: Verified 增加了 %d, want 1", got)
+			}
+		})
+	}
+}
+
+// roundTripFunc 把函数适配为 http.RoundTripper，测试中代替真实的 Smarty 服务
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestWorkerRetryExhaustedWritesFailedJob(t *testing.T) {
+	r := newRunner(Config{
+		Credentials: []credential.ApiCredential{{AuthID: "id", AuthToken: "token"}},
+		MaxRetries:  0,
+		SDKMaxRetry: 0,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: io.NopCloser(strings.NewReader("")), Request: r}, nil
+		})},
+	})
+
+	results, failed := runWorker(t, r, testWorkerAddress("1 Main St"))
+
+	if len(results) != 0 || len(failed) != 1 {
+		t.Fatalf("results = %d, failed = %d，want 0, 1", len(results), len(failed))
+	}
+	if want := reasonVerifyFailed + ": "; !strings.HasPrefix(failed[0].FailReason, want) {
+		t.Errorf("FailReason = %q，want 以 %q 开头", failed[0].FailReason, want)
+	}
+	if got := r.progress.Snapshot().Failed; got != 1 {
+		t.Errorf("重试耗尽的地址应只计一次失败: Failed 增加了 %d", got)
+	}
+}
+
+func TestWorkerCredentialsExhaustedReleasesBudget(t *testing.T) {
+	r := newRunner(Config{
+		MatchChain: []street.MatchStrategy{street.MatchStrict, street.MatchEnhanced},
+		MaxLookups: 10,
+	})
+
+	results, failed := runWorker(t, r, testWorkerAddress("1 Main St"), testWorkerAddress("2 Main St"))
+
+	if len(results) != 0 || len(failed) != 2 {
+		t.Fatalf("results = %d, failed = %d，want 0, 2", len(results), len(failed))
+	}
+	for _, addr := range failed {
+		if addr.FailReason != reasonCredentialsExhausted {
+			t.Errorf("FailReason = %q, want %q", addr.FailReason, reasonCredentialsExhausted)
+		}
+	}
+	if got := r.budget.Used(); got != 0 {
+		t.Errorf("没有发送的地址不应占用查询预算: Used() = %d", got)
+	}
+}
+
+// testWorkerAddress 返回一个需要验证的地址
+func testWorkerAddress(street string) *model.Address {
+	return &model.Address{Street: street, City: "Austin", State: "TX", Zip: "78701", Link: "https://example.com/" + street}
+}
+
+func TestWorkerSplitsBatchAtCredentialLimit(t *testing.T) {
+	t.Setenv(credential.ExtraCredentialsEnv, "")
+	// sent 记录每个凭证发送的地址数量
+	var mu sync.Mutex
+	sent := map[string]int{}
+	r := newRunner(Config{
+		Credentials: []credential.ApiCredential{
+			{AuthID: "free", AuthToken: "token", MaxUsage: 2},
+			{AuthID: "paid", AuthToken: "token", MaxUsage: 5},
+		},
+		BatchSize:   5,
+		SDKMaxRetry: 0,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			lookups, err := countLookups(r)
+			sent[r.URL.Query().Get("auth-id")] += lookups
+			return verifiedResponse(r, lookups), err
+		})},
+	})
+
+	var addrs []*model.Address
+	for i := range 5 {
+		addrs = append(addrs, testWorkerAddress(fmt.Sprintf("%d Main St", i+1)))
+	}
+	results, failed := runWorker(t, r, addrs...)
+
+	if len(results) != 5 || len(failed) != 0 {
+		t.Fatalf("results = %d, failed = %d，want 5, 0", len(results), len(failed))
+	}
+	// 第一个凭证的额度容纳不下整个批次，只发送 2 个地址，其余的改用下一个凭证
+	if sent["free"] != 2 || sent["paid"] != 3 {
+		t.Errorf("各凭证发送的地址数量 = %v，want free: 2, paid: 3", sent)
+	}
+	if got := r.apiManager.UsedCredentials(); got != 2 {
+		t.Errorf("UsedCredentials() = %d, want 2", got)
+	}
+}
+
+func TestWorkerUsedCredentialsSkipsInvalidated(t *testing.T) {
+	t.Setenv(credential.ExtraCredentialsEnv, "")
+	r := newRunner(Config{
+		Credentials: []credential.ApiCredential{
+			{AuthID: "revoked", AuthToken: "token"},
+			{AuthID: "unused", AuthToken: "token", MaxUsage: 1},
+			{AuthID: "valid", AuthToken: "token"},
+		},
+		BatchSize:  2,
+		MaxRetries: 1,
+		// 每个地址预留两次查询，MaxUsage 为 1 的凭证连一个地址都容纳不下
+		MatchChain:     []street.MatchStrategy{street.MatchStrict, street.MatchEnhanced},
+		SDKMaxRetry:    0,
+		InitialBackoff: time.Millisecond,
+		HTTPClient: &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			lookups, err := countLookups(r)
+			if r.URL.Query().Get("auth-id") == "revoked" {
+				return &http.Response{StatusCode: http.StatusUnauthorized, Body: io.NopCloser(strings.NewReader("")), Request: r}, err
+			}
+			return verifiedResponse(r, lookups), err
+		})},
+	})
+
+	results, failed := runWorker(t, r, testWorkerAddress("1 Main St"), testWorkerAddress("2 Main St"))
+
+	if len(results) != 2 || len(failed) != 0 {
+		t.Fatalf("results = %d, failed = %d，want 2, 0", len(results), len(failed))
+	}
+	// revoked 认证失败被标记失效，unused 的额度不足而被跳过，都不计入
+	if got := r.apiManager.UsedCredentials(); got != 1 {
+		t.Errorf("UsedCredentials() = %d, want 1", got)
+	}
+}
+
+// countLookups 返回 SDK 请求中的地址数量：单个地址使用 GET 查询参数，多个地址使用 POST JSON 数组
+func countLookups(r *http.Request) (int, error) {
+	if r.Method != http.MethodPost {
+		return 1, nil
+	}
+	var batch []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		return 0, err
+	}
+	return len(batch), nil
+}
+
+// verifiedResponse 返回 lookups 个地址全部验证成功的 Smarty 响应
+func verifiedResponse(r *http.Request, lookups int) *http.Response {
+	var body strings.Builder
+	body.WriteString("[")
+	for i := range lookups {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		fmt.Fprintf(&body, `{"input_index":%d,"analysis":{"dpv_match_code":"Y","dpv_cmra":"N"},"metadata":{"rdi":"Commercial"}}`, i)
+	}
+	body.WriteString("]")
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body.String())), Request: r}
+}
+
+func TestFilterAvailable(t *testing.T) {
+	addresses := []model.Address{
+		{Street: "1 E Main St", Status: model.StatusAvailable},
+		{Street: "2398 E Camelback Rd", Status: model.StatusComingSoon},
+		// 没有状态的地址 (如输入文件中的地址) 视为可租用
+		{Street: "5425 N Oracle Rd"},
+	}
+
+	got := filterAvailable(1, "arizona", addresses)
+
+	var streets []string
+	for _, addr := range got {
+		streets = append(streets, addr.Street)
+	}
+	if want := []string{"1 E Main St", "5425 N Oracle Rd"}; !slices.Equal(streets, want) {
+		t.Errorf("filterAvailable() 保留了 %q，want %q", streets, want)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"atmb/output"
+	"atmb/pipeline"
+)
+
+// runReportFile 是每次运行结束时写入的运行报告
+const runReportFile = "run_report.json"
+
+// runReport 是 run_report.json 的内容，汇总一次运行的时间、抓取、验证和凭证使用情况，便于留档审计
+type runReport struct {
+	StartTime       time.Time             `json:"start_time"`
+	EndTime         time.Time             `json:"end_time"`
+	DurationSeconds float64               `json:"duration_seconds"`
+	Cause           string                `json:"cause"`
+	ExitCode        int                   `json:"exit_code"`
+	TotalStates     int64                 `json:"total_states"`
+	StatesProcessed int64                 `json:"states_processed"`
+	StateErrors     []pipeline.StateError `json:"state_errors"`
+	Discovered      int64                 `json:"addresses_discovered"`
+	Verified        int64                 `json:"addresses_verified"`
+	Failed          int64                 `json:"addresses_failed"`
+	Results         output.ResultTotals   `json:"results"`
+	CredentialsUsed int                   `json:"credentials_used"`
+	SmartyLookups   int64                 `json:"smarty_lookups"`
+}
+
+// newRunReport 汇总从 start 开始的这次运行
+func newRunReport(start time.Time, run pipeline.Results) runReport {
+	end := time.Now()
+	progress := run.Progress
+	return runReport{
+		StartTime:       start,
+		EndTime:         end,
+		DurationSeconds: end.Sub(start).Seconds(),
+		Cause:           run.Cause.String(),
+		ExitCode:        run.Cause.ExitCode(),
+		TotalStates:     progress.TotalStates,
+		StatesProcessed: progress.StatesDone,
+		StateErrors:     run.StateErrors,
+		Discovered:      progress.Discovered,
+		Verified:        progress.Verified,
+		Failed:          progress.Failed,
+		Results:         run.Stats.Totals(),
+		CredentialsUsed: run.CredentialsUsed,
+		SmartyLookups:   run.Lookups,
+	}
+}
+
+// writeRunReport 将运行报告以 JSON 格式写入 filename
+func writeRunReport(filename string, report runReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("格式化运行报告失败: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("写入运行报告失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,421 @@
+// Package scrape 负责从 anytimemailbox.com 抓取州列表和各州的地址信息。
+package scrape
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"atmb/model"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultMaxBodySize 是抓取页面时允许的默认最大响应体大小 (10MB)
+const DefaultMaxBodySize = 10 << 20
+
+// MaxBodySize 是抓取页面时允许的最大响应体大小
+var MaxBodySize int64 = DefaultMaxBodySize
+
+// lastFetchFailed 记录最近一次页面抓取是否失败
+var lastFetchFailed atomic.Bool
+
+// LastFetchSucceeded 报告最近一次页面抓取是否成功，尚未抓取时视为成功
+func LastFetchSucceeded() bool {
+	return !lastFetchFailed.Load()
+}
+
+// SkipLinklessCards 为 true 时跳过没有链接的地址卡片，否则保留这些卡片并将 Link 留空
+var SkipLinklessCards bool
+
+// ErrBodyTooLarge 表示页面响应体超过了 MaxBodySize 限制
+var ErrBodyTooLarge = errors.New("response body too large")
+
+// ErrParseDocument 表示响应体为空或无法解析为 HTML 文档，通常是临时故障，可以重新抓取
+var ErrParseDocument = errors.New("parse document failed")
+
+// parseRetries 是页面无法解析时重新抓取的次数
+const parseRetries = 2
+
+// Retryable 判断抓取州页面返回的错误是否值得重新抓取整个州。
+// 被站点拦截 (ErrBlocked) 时同样可以重试，但调用方应先退避一段时间。
+func Retryable(err error) bool {
+	return errors.Is(err, ErrIncompleteState) || errors.Is(err, ErrParseDocument) || errors.Is(err, ErrBlocked)
+}
+
+// ErrNoStates 表示州列表页面抓取成功，但其中没有任何州的链接 (页面结构可能已经改变)
+var ErrNoStates = errors.New("no states found on locations page")
+
+// GetState 抓取所有州的显示名称和 slug (州地址页 /l/usa/<slug> 中的路径)，按 slug 去重并排序后返回。
+// 页面无法获取或其中没有州的链接时返回错误，由调用方决定退出还是改用其他州列表。
+func GetState(ctx context.Context) ([]State, error) {
+	log.Println("正在获取州信息")
+	url := "https://www.anytimemailbox.com/locations"
+
+	doc, err := fetchDocument(ctx, url)
+	for attempt := 1; errors.Is(err, ErrParseDocument) && attempt <= parseRetries; attempt++ {
+		log.Printf("州列表页面解析失败，正在重新抓取 (%d/%d): %v", attempt, parseRetries, err)
+		doc, err = fetchDocument(ctx, url)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取州信息失败: %w", err)
+	}
+
+	states := parseStateLinks(doc)
+	if len(states) == 0 {
+		return nil, ErrNoStates
+	}
+	log.Println("获取州信息完毕")
+	return states, nil
+}
+
+// parseStateLinks 从州列表页面中提取所有州的名称和 slug，按 slug 去重并排序。
+// 链接文本只用于显示，GetStateDetail 使用的 URL 由 href 中的 slug 决定：
+// 文本相同但 slug 不同的链接保留为不同的州，同一个 slug 只保留第一次出现时的名称。
+func parseStateLinks(doc *goquery.Document) []State {
+	var states []State
+	seen := make(map[string]bool)
+	// 使用 CSS 选择器查找所有 href 以 "/l/usa/" 开头的 <a> 标签
+	// 这是定位州链接最可靠的方法
+	doc.Find(`a[href^="` + statePathPrefix + `"]`).Each(func(i int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		name := strings.Join(strings.Fields(s.Text()), " ")
+		slug, ok := stateLinkSlug(href)
+		if !ok {
+			log.Printf("警告: 跳过无法识别 slug 的州链接 %q (%s)", href, name)
+			return
+		}
+		if seen[slug] {
+			return
+		}
+		seen[slug] = true
+		states = append(states, State{Name: name, Slug: slug})
+	})
+	sort.Slice(states, func(i, j int) bool { return states[i].Slug < states[j].Slug })
+	return states
+}
+
+// stateLinkSlug 从形如 /l/usa/<slug> 的链接中取出州的 slug，忽略查询参数、锚点和 slug 之后的路径
+func stateLinkSlug(href string) (string, bool) {
+	rest, ok := strings.CutPrefix(href, statePathPrefix)
+	if !ok {
+		return "", false
+	}
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	slug, _, _ := strings.Cut(rest, "/")
+	slug = strings.ToLower(slug)
+	return slug, slugRe.MatchString(slug)
+}
+
+// GetStateDetail 抓取指定州页面上的所有地址。
+// 州页面分页时会继续抓取其余页面，中途失败的页面按 PaginationFailureMode 处理。
+// 第一页被站点拦截 (状态码 403/429 或验证码等拦截页面) 时返回包装了 ErrBlocked 的错误，而不是空的地址列表。
+// ctx 被取消或超时后，正在进行的请求会被中止并返回 ctx 的错误。
+func GetStateDetail(ctx context.Context, state string) ([]model.Address, error) {
+	log.Printf("正在获取 %s 详细信息\n", state)
+	// 目标 URL
+	url := "https://www.anytimemailbox.com/l/usa/" + state
+
+	doc, err := fetchDocument(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 详细信息失败: %w", state, err)
+	}
+	parsedAddresses, err := parseStateDocument(doc, state)
+	if err != nil {
+		return nil, fmt.Errorf("获取 %s 详细信息失败: %w", state, err)
+	}
+
+	more, err := fetchRemainingPages(ctx, state, doc, url)
+	if err != nil {
+		return nil, err
+	}
+	parsedAddresses = append(parsedAddresses, more...)
+	n := len(parsedAddresses)
+	parsedAddresses = dedupeByLink(parsedAddresses)
+	if removed := n - len(parsedAddresses); removed > 0 {
+		log.Printf("%s 的分页中有 %d 个重复的地址，已去除。", state, removed)
+	}
+
+	log.Printf("获取 %s 详细信息完毕，共有 %d 个地址\n", state, len(parsedAddresses))
+	return parsedAddresses, nil
+}
+
+// ParseStateDetail 解析一个州页面的 HTML，返回页面上的所有地址，不发出任何网络请求，
+// 可以用保存下来的页面检查解析规则 (见 -selftest-html)。stateSlug 只用于日志和错误信息。
+// 只解析给定的这一页，不会抓取分页中的其他页面；页面是拦截页面时返回包装了 ErrBlocked 的错误。
+func ParseStateDetail(html io.Reader, stateSlug string) ([]model.Address, error) {
+	doc, err := goquery.NewDocumentFromReader(html)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrParseDocument, stateSlug, err)
+	}
+	return parseStateDocument(doc, stateSlug)
+}
+
+// parseStateDocument 检查州页面是否被拦截，并解析其中的地址卡片
+func parseStateDocument(doc *goquery.Document, stateSlug string) ([]model.Address, error) {
+	if err := checkBlocked(doc); err != nil {
+		return nil, err
+	}
+	addresses := parseLocations(doc)
+	slog.Debug("解析州页面", "state", stateSlug, "addresses", len(addresses))
+	return addresses, nil
+}
+
+// parseLocations 解析单个页面上的所有地址卡片
+func parseLocations(doc *goquery.Document) []model.Address {
+	var parsedAddresses []model.Address
+
+	priceRe := regexp.MustCompile(`\d+\.\d+`)
+	// 街道与城市之间可能还有单独一行 Suite/Unit 等二级地址
+	streetRe := regexp.MustCompile(`(?i)(.*?)\s*<br\s*/?>\s*(?:(.*?)\s*<br\s*/?>\s*)?(.*?),?\s*([A-Z]{2})\s+(\d{5})`)
+
+	// 查找所有包含地址信息的卡片元素
+	doc.Find(".theme-location-item").Each(func(i int, s *goquery.Selection) {
+		// 在卡片内提取城市、州和邮编所在的行
+		title := s.Find("h3.t-title").Text()
+
+		price := s.Find("div.t-price>b").Text()
+		price = priceRe.FindString(price)
+
+		streetAddress, err := s.Find("div.t-addr").Html()
+		if err != nil {
+			log.Println("提取地址失败: ", err)
+		}
+
+		// 地址格式与预期不同 (如 PO Box、缺少邮编) 时无法解析，跳过该卡片而不是让整个工作单元崩溃
+		streetMatch := streetRe.FindStringSubmatch(streetAddress)
+		if len(streetMatch) < 6 {
+			log.Printf("警告: 无法解析地址卡片的地址，已跳过: %s", strings.TrimSpace(title))
+			slog.Debug("无法解析的地址 HTML", "title", strings.TrimSpace(title), "html", streetAddress)
+			return
+		}
+		street, secondary := splitSecondary(strings.TrimSpace(streetMatch[1]))
+		if line := strings.TrimSpace(streetMatch[2]); line != "" {
+			secondary = strings.TrimSpace(strings.Join([]string{secondary, line}, " "))
+		}
+		city := strings.TrimSpace(streetMatch[3])
+		state := strings.TrimSpace(streetMatch[4])
+		zip := strings.TrimSpace(streetMatch[5])
+
+		// 没有链接的卡片不能拼接出有效的 Link，按 SkipLinklessCards 跳过或保留为空
+		link := ""
+		if href := strings.TrimSpace(s.Find("a").AttrOr("href", "")); href != "" {
+			link = "https://www.anytimemailbox.com" + href
+		} else if SkipLinklessCards {
+			log.Printf("警告: 地址卡片没有链接，已跳过: %s (%s, %s)", title, street, city)
+			return
+		} else {
+			log.Printf("警告: 地址卡片没有链接，Link 将为空: %s (%s, %s)", title, street, city)
+		}
+
+		addr := model.Address{
+			Status:     parseStatus(s),
+			Title:      title,
+			Price:      price,
+			PriceCents: model.ParsePriceCents(price),
+			Street:     street,
+			Secondary:  secondary,
+			City:       city,
+			State:      state,
+			Zip:        zip,
+			Link:       link,
+			RDI:        "UNKNOWN",
+			CMRA:       "UNKNOWN",
+		}
+		if ParseTitles {
+			addr.LocationName, addr.Descriptor = ParseTitle(title)
+		}
+		parsedAddresses = append(parsedAddresses, addr)
+
+	})
+
+	return parsedAddresses
+}
+
+// secondaryRe 匹配街道行末尾的二级地址，如 "Ste 100"、"Suite #200"、"Unit B"、"#305"。
+// 编号必须包含数字或是单个字母，避免把 "Unit Rd" 这样的街道名误拆。
+var secondaryRe = regexp.MustCompile(`(?i)^(.+?)[\s,]+((?:suite|ste|unit|apt|room|rm|#)\.?\s*#?\s*(?:[A-Z-]*\d[\w-]*|[A-Z]))$`)
+
+// splitSecondary 将街道行拆分为街道和二级地址 (Suite、Unit、# 等)，没有二级地址时 secondary 为空
+func splitSecondary(line string) (street, secondary string) {
+	m := secondaryRe.FindStringSubmatch(line)
+	if m == nil {
+		return line, ""
+	}
+	return strings.TrimRight(m[1], " ,"), m[2]
+}
+
+// comingSoonRe 匹配尚未开业地点卡片上的状态标记
+var comingSoonRe = regexp.MustCompile(`(?i)coming\s+soon|opening\s+soon`)
+
+// parseStatus 根据卡片上的状态标记判断地点是否已经开业。
+// 优先查找状态标签元素，没有时检查整张卡片的文本；都没有标记时视为可租用。
+func parseStatus(card *goquery.Selection) string {
+	text := card.Find(".t-status, .badge, .label, .ribbon").Text()
+	if text == "" {
+		text = card.Text()
+	}
+	if comingSoonRe.MatchString(text) {
+		return model.StatusComingSoon
+	}
+	return model.StatusAvailable
+}
+
+// 抓取页面遇到临时故障 (超时、连接错误、5xx、429) 时的重试次数和初始退避时间
+const (
+	fetchRetries        = 3
+	initialFetchBackoff = time.Second
+)
+
+// errTransient 标记可以重试的临时故障
+var errTransient = errors.New("临时故障")
+
+// fetchDocument 请求指定页面并将响应体解析为 goquery document。
+// 遇到临时故障时按指数退避重试最多 fetchRetries 次，仍然失败或遇到其他错误 (如 404) 时返回错误。
+// ctx 被取消或超时后不再重试，立即返回 ctx 的错误。
+func fetchDocument(ctx context.Context, url string) (doc *goquery.Document, err error) {
+	defer func() { lastFetchFailed.Store(err != nil) }()
+
+	backoff := initialFetchBackoff
+	for attempt := 0; ; attempt++ {
+		doc, err = fetchOnce(ctx, url)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err == nil || !errors.Is(err, errTransient) || attempt >= fetchRetries {
+			return doc, err
+		}
+		log.Printf("抓取 %s 失败 (尝试 %d/%d)，将在 %v 后重试: %v", url, attempt+1, fetchRetries+1, backoff, err)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// sleepContext 等待 d，ctx 被取消时提前返回 ctx 的错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// fetchOnce 请求一次页面并解析响应体。
+// 响应体大小受 MaxBodySize 限制，超过上限时返回错误，防止异常响应耗尽内存。
+func fetchOnce(ctx context.Context, url string) (*goquery.Document, error) {
+	// 发起 HTTP GET 请求，User-Agent 等请求头由共用的 httpClient 补充
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	// 显式声明支持压缩。手动设置该请求头后 Transport 不再自动解压，由 decodeBody 负责解压
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+
+	// 所有工作单元共用同一个限速器，合计速率不超过 RequestsPerSecond
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		// 超时、连接被重置等网络错误通常是暂时的
+		return nil, fmt.Errorf("%w: 请求失败: %w", errTransient, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			log.Println("fetchDocument 退出错误: ", err)
+		}
+	}()
+
+	recordStatusCode(res.StatusCode)
+
+	// 确保请求成功，服务端错误和限流可以重试，其他状态码 (如 404) 重试也没有意义
+	if res.StatusCode != http.StatusOK {
+		if res.StatusCode == http.StatusTooManyRequests {
+			return nil, fmt.Errorf("%w: %w: 状态码 %s", errTransient, ErrBlocked, res.Status)
+		}
+		if res.StatusCode == http.StatusForbidden {
+			return nil, fmt.Errorf("%w: 状态码 %s", ErrBlocked, res.Status)
+		}
+		if res.StatusCode >= 500 {
+			return nil, fmt.Errorf("%w: 状态码 %s", errTransient, res.Status)
+		}
+		return nil, fmt.Errorf("请求错误: 状态码 %s", res.Status)
+	}
+
+	reader, err := decodeBody(res)
+	if err != nil {
+		return nil, err
+	}
+
+	// 多读取一个字节，用于判断响应体是否超出上限。限制作用于解压后的内容，防止压缩炸弹
+	body, err := io.ReadAll(io.LimitReader(reader, MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: 读取响应体失败: %w", errTransient, err)
+	}
+	if int64(len(body)) > MaxBodySize {
+		return nil, fmt.Errorf("%w: 超过 %d 字节", ErrBodyTooLarge, MaxBodySize)
+	}
+
+	return parseDocument(body)
+}
+
+// parseDocument 将 HTML 响应体加载到 goquery document 中。
+// 响应体为空或解析失败时返回 ErrParseDocument，而不是返回一个无法使用的 document。
+func parseDocument(body []byte) (*goquery.Document, error) {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("%w: 响应体为空", ErrParseDocument)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrParseDocument, err)
+	}
+	return doc, nil
+}
+
+// decodeBody 根据 Content-Encoding 返回解压后的响应体
+func decodeBody(res *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return res.Body, nil
+	case "gzip":
+		gz, err := gzip.NewReader(res.Body)
+		if err != nil {
+			return nil, fmt.Errorf("解压 gzip 响应失败: %w", err)
+		}
+		return gz, nil
+	case "deflate":
+		// 按规范 deflate 应为 zlib 格式，但部分服务器直接返回原始 deflate 数据
+		br := bufio.NewReader(res.Body)
+		if header, err := br.Peek(2); err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return nil, fmt.Errorf("解压 deflate 响应失败: %w", err)
+			}
+			return zr, nil
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("不支持的 Content-Encoding: %s", res.Header.Get("Content-Encoding"))
+	}
+}
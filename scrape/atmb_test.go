@@ -0,0 +1,265 @@
+package scrape
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"atmb/model"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func newTestDocument(t *testing.T, html string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("解析 HTML 失败: %v", err)
+	}
+	return doc
+}
+
+func TestParseStateLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []State
+	}{
+		{
+			name: "slug 与显示名称不同",
+			html: `<a href="/l/usa/new-york">New York</a><a href="/l/usa/district-of-columbia">Washington, D.C.</a>`,
+			want: []State{{Name: "Washington, D.C.", Slug: "district-of-columbia"}, {Name: "New York", Slug: "new-york"}},
+		},
+		{
+			name: "同一个 slug 只保留第一次出现时的名称",
+			html: `<a href="/l/usa/new-york">New York</a><a href="/l/usa/new-york?ref=nav">NY</a><a href="/l/usa/new-york#top">New York State</a>`,
+			want: []State{{Name: "New York", Slug: "new-york"}},
+		},
+		{
+			name: "文本相同但 slug 不同的链接保留为不同的州",
+			html: `<a href="/l/usa/georgia">Georgia</a><a href="/l/usa/georgia-country">Georgia</a>`,
+			want: []State{{Name: "Georgia", Slug: "georgia"}, {Name: "Georgia", Slug: "georgia-country"}},
+		},
+		{
+			name: "忽略大小写、末尾斜杠、多余空白和 slug 之后的路径",
+			html: `<a href="/l/usa/California/">  California
+				</a><a href="/l/usa/texas/austin-congress-ave">Austin</a>`,
+			want: []State{{Name: "California", Slug: "california"}, {Name: "Austin", Slug: "texas"}},
+		},
+		{
+			name: "跳过没有有效 slug 的链接",
+			html: `<a href="/l/usa/">USA</a><a href="/l/usa/?page=2">Next</a><a href="/l/usa/ohio">Ohio</a><a href="/l/canada/ontario">Ontario</a>`,
+			want: []State{{Name: "Ohio", Slug: "ohio"}},
+		},
+		{
+			name: "没有州链接",
+			html: `<p>Locations</p>`,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseStateLinks(newTestDocument(t, tt.html))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStateLinks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStateSlug(t *testing.T) {
+	tests := []struct {
+		value, want string
+		wantErr     bool
+	}{
+		{value: "new-york", want: "new-york"},
+		{value: "New York", want: "new-york"},
+		{value: " /l/usa/california/ ", want: "california"},
+		{value: "https://www.anytimemailbox.com/l/usa/north-carolina", want: "north-carolina"},
+		{value: "new_york", wantErr: true},
+		{value: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseStateSlug(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseStateSlug(%q) = %q, %v; want %q (错误: %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// testAddress 返回解析结果中默认的地址字段，CMRA 和 RDI 在验证前都是 UNKNOWN
+func testAddress(addr model.Address) model.Address {
+	addr.Status = model.StatusAvailable
+	addr.PriceCents = model.ParsePriceCents(addr.Price)
+	addr.CMRA, addr.RDI = "UNKNOWN", "UNKNOWN"
+	return addr
+}
+
+// comingSoon 把 addr 标记为即将开业
+func comingSoon(addr model.Address) model.Address {
+	addr.Status = model.StatusComingSoon
+	return addr
+}
+
+func TestParseStateDetail(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []model.Address
+	}{
+		{
+			fixture: "state_normal.html",
+			want: []model.Address{testAddress(model.Address{
+				Title: "Austin - Congress Ave", Price: "14.99",
+				Street: "100 Congress Ave", City: "Austin", State: "TX", Zip: "78701",
+				Link: "https://www.anytimemailbox.com/s/austin-100-congress-ave",
+			})},
+		},
+		{
+			fixture: "state_pobox.html",
+			want: []model.Address{testAddress(model.Address{
+				Title: "Juneau - Downtown", Price: "9.99",
+				Street: "PO Box 2210", City: "Juneau", State: "AK", Zip: "99803",
+				Link: "https://www.anytimemailbox.com/s/juneau-po-box-2210",
+			})},
+		},
+		{
+			fixture: "state_suite.html",
+			want: []model.Address{
+				testAddress(model.Address{
+					Title: "Denver - 17th St", Price: "19.99",
+					Street: "1600 17th St", Secondary: "Ste 200", City: "Denver", State: "CO", Zip: "80202",
+					Link: "https://www.anytimemailbox.com/s/denver-1600-17th-st",
+				}),
+				testAddress(model.Address{
+					Title: "Boulder - Pearl St", Price: "24.50",
+					Street: "2995 Pearl St", Secondary: "Unit B", City: "Boulder", State: "CO", Zip: "80301",
+					Link: "https://www.anytimemailbox.com/s/boulder-2995-pearl-st",
+				}),
+			},
+		},
+		{
+			// 地址行无法解析 (没有街道、缺少邮编或没有地址) 的卡片被跳过，不影响同一页面的其他卡片
+			fixture: "state_malformed.html",
+			want: []model.Address{testAddress(model.Address{
+				Title: "Las Vegas - Strip", Price: "15.99",
+				Street: "3960 Howard Hughes Pkwy", City: "Las Vegas", State: "NV", Zip: "89169",
+				Link: "https://www.anytimemailbox.com/s/las-vegas-3960-howard-hughes-pkwy",
+			})},
+		},
+		{
+			// 带有即将开业标记 (状态标签或卡片文本) 的地点仍然解析，Status 为 coming soon
+			fixture: "state_coming_soon.html",
+			want: []model.Address{
+				comingSoon(testAddress(model.Address{
+					Title: "Phoenix - Camelback Rd", Price: "12.99",
+					Street: "2398 E Camelback Rd", City: "Phoenix", State: "AZ", Zip: "85016",
+					Link: "https://www.anytimemailbox.com/s/phoenix-2398-e-camelback-rd",
+				})),
+				comingSoon(testAddress(model.Address{
+					Title: "Tucson - Oracle Rd", Price: "10.99",
+					Street: "5425 N Oracle Rd", City: "Tucson", State: "AZ", Zip: "85704",
+					Link: "https://www.anytimemailbox.com/s/tucson-5425-n-oracle-rd",
+				})),
+				testAddress(model.Address{
+					Title: "Mesa - Main St", Price: "9.99",
+					Street: "1 E Main St", City: "Mesa", State: "AZ", Zip: "85201",
+					Link: "https://www.anytimemailbox.com/s/mesa-1-e-main-st",
+				}),
+			},
+		},
+		{
+			fixture: "state_empty.html",
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			got, err := ParseStateDetail(f, strings.TrimSuffix(tt.fixture, ".html"))
+			if err != nil {
+				t.Fatalf("ParseStateDetail() 返回错误: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStateDetail() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStateDetailLinklessCards(t *testing.T) {
+	portland := testAddress(model.Address{
+		Title: "Portland - Pearl District", Price: "12.99",
+		Street: "1200 NW Naito Pkwy", City: "Portland", State: "OR", Zip: "97209",
+		Link: "https://www.anytimemailbox.com/s/portland-1200-nw-naito-pkwy",
+	})
+	salem := testAddress(model.Address{
+		Title: "Salem - Downtown", Price: "9.99",
+		Street: "388 State St", City: "Salem", State: "OR", Zip: "97301",
+	})
+	tests := []struct {
+		skip bool
+		want []model.Address
+	}{
+		{skip: false, want: []model.Address{portland, salem}},
+		{skip: true, want: []model.Address{portland}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("SkipLinklessCards=%v", tt.skip), func(t *testing.T) {
+			saved := SkipLinklessCards
+			SkipLinklessCards = tt.skip
+			t.Cleanup(func() { SkipLinklessCards = saved })
+
+			f, err := os.Open(filepath.Join("testdata", "state_linkless.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			got, err := ParseStateDetail(f, "state_linkless")
+			if err != nil {
+				t.Fatalf("ParseStateDetail() 返回错误: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseStateDetail() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDocumentErrors(t *testing.T) {
+	for _, body := range []string{"", "  \n\t "} {
+		if _, err := parseDocument([]byte(body)); !errors.Is(err, ErrParseDocument) {
+			t.Errorf("parseDocument(%q) error = %v, want ErrParseDocument", body, err)
+		}
+	}
+	if doc, err := parseDocument([]byte("<p>Locations")); err != nil || doc == nil {
+		t.Errorf("parseDocument() 不应拒绝不完整但可以解析的 HTML: %v", err)
+	}
+
+	// 状态码为 200 但响应体为空的页面
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	if _, err := fetchOnce(t.Context(), srv.URL); !errors.Is(err, ErrParseDocument) {
+		t.Errorf("fetchOnce() 空响应体 error = %v, want ErrParseDocument", err)
+	}
+
+	// 读取响应体失败时无法得到 document
+	_, err := ParseStateDetail(iotest.ErrReader(errors.New("connection reset")), "texas")
+	if !errors.Is(err, ErrParseDocument) {
+		t.Errorf("ParseStateDetail() error = %v, want ErrParseDocument", err)
+	}
+	if !Retryable(err) {
+		t.Errorf("Retryable(%v) = false，ErrParseDocument 应重新抓取", err)
+	}
+}
@@ -0,0 +1,55 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// ErrBlocked 表示请求被站点拦截：返回了 403/429，或者返回的是验证码、访问拒绝等拦截页面。
+// 拦截页面没有地址卡片，如果不加区分会被误当作没有地址的州。
+var ErrBlocked = errors.New("blocked by anytimemailbox.com")
+
+// blockMarkerRe 匹配常见的验证码、人机验证和访问拒绝页面中的文字
+var blockMarkerRe = regexp.MustCompile(`(?i)captcha|are you a robot|verify you are human|unusual traffic|access denied|attention required|just a moment\.\.\.|request blocked|too many requests|rate limit`)
+
+// blockSelector 匹配验证码和人机验证页面中的元素
+const blockSelector = `.g-recaptcha, .h-captcha, #challenge-form, #cf-challenge-running, iframe[src*="captcha"], iframe[src*="challenge"]`
+
+// minPageText 是正常州页面至少应有的文本长度；没有地址卡片且文本少于该长度的页面视为异常
+const minPageText = 200
+
+// checkBlocked 检查没有地址卡片的州页面是否是拦截页面，是时返回包装了 ErrBlocked 的错误。
+// 带有地址卡片的页面总是视为正常页面。
+func checkBlocked(doc *goquery.Document) error {
+	if doc.Find(".theme-location-item").Length() > 0 {
+		return nil
+	}
+	if doc.Find(blockSelector).Length() > 0 {
+		return fmt.Errorf("%w: 页面包含验证码或人机验证", ErrBlocked)
+	}
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	if marker := blockMarkerRe.FindString(text); marker != "" {
+		return fmt.Errorf("%w: 页面包含拦截标记 %q", ErrBlocked, marker)
+	}
+	if len(text) < minPageText {
+		return fmt.Errorf("%w: 页面没有地址卡片且内容异常简短 (%d 个字符)", ErrBlocked, len(text))
+	}
+	return nil
+}
+
+// fetchStatePage 抓取州的一个页面，并检查返回的是否是拦截页面
+func fetchStatePage(ctx context.Context, url string) (*goquery.Document, error) {
+	doc, err := fetchDocument(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBlocked(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
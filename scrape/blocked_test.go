@@ -0,0 +1,69 @@
+package scrape
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseStateDetailBlockedPage(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "state_blocked.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := ParseStateDetail(f, "state_blocked")
+	if !errors.Is(err, ErrBlocked) || got != nil {
+		t.Fatalf("ParseStateDetail() = %v, %v; want nil, ErrBlocked", got, err)
+	}
+	if !Retryable(err) {
+		t.Errorf("Retryable(%v) = false，拦截页面应退避后重新抓取", err)
+	}
+}
+
+func TestCheckBlocked(t *testing.T) {
+	// filler 使页面文本超过 minPageText，排除内容过短的判断
+	filler := "<p>" + strings.Repeat("Choose a location below to get a real street address. ", 5) + "</p>"
+	tests := []struct {
+		name    string
+		html    string
+		blocked bool
+	}{
+		{name: "reCAPTCHA 元素", html: filler + `<div class="g-recaptcha"></div>`, blocked: true},
+		{name: "验证码 iframe", html: filler + `<iframe src="https://challenges.example.com/captcha"></iframe>`, blocked: true},
+		{name: "拦截文字", html: filler + `<p>Access Denied. You don't have permission to access this page.</p>`, blocked: true},
+		{name: "限流文字", html: filler + `<p>Too Many Requests</p>`, blocked: true},
+		{name: "没有卡片且内容过短", html: `<p>Loading</p>`, blocked: true},
+		{name: "没有卡片的正常页面", html: filler},
+		{
+			name: "有地址卡片时忽略拦截标记",
+			html: `<div class="theme-location-item"><div class="t-addr">1 Main St<br>Austin, TX 78701</div></div><p>Protected by reCAPTCHA</p>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkBlocked(newTestDocument(t, tt.html))
+			if errors.Is(err, ErrBlocked) != tt.blocked {
+				t.Errorf("checkBlocked() = %v, want blocked %v", err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestFetchOnceBlockedStatus(t *testing.T) {
+	for _, code := range []int{http.StatusForbidden, http.StatusTooManyRequests} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		_, err := fetchOnce(t.Context(), srv.URL)
+		srv.Close()
+		if !errors.Is(err, ErrBlocked) {
+			t.Errorf("状态码 %d: fetchOnce() error = %v, want ErrBlocked", code, err)
+		}
+	}
+}
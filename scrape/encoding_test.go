@@ -0,0 +1,121 @@
+package scrape
+
+import (
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// testStatePage 返回一个包含 n 张地址卡片的州页面
+func testStatePage(n int) []byte {
+	var b strings.Builder
+	b.WriteString(`<html><body><h1>Virtual Mailbox and Virtual Address Locations</h1><div class="theme-location-list">`)
+	for i := range n {
+		fmt.Fprintf(&b, `<div class="theme-location-item">
+  <h3 class="t-title">Austin - Location %d</h3>
+  <div class="t-price">Starting from <b>US$ 14.99</b> / month</div>
+  <div class="t-addr">%d Congress Ave<br>Austin, TX 78701</div>
+  <a class="t-button" href="/s/austin-%d-congress-ave">Select Plan</a>
+</div>
+`, i, 100+i, 100+i)
+	}
+	b.WriteString(`</div></body></html>`)
+	return []byte(b.String())
+}
+
+// compress 按 encoding 压缩 page，encoding 为空时原样返回
+func compress(t testing.TB, encoding string, page []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "":
+		return page
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := w.Write(page); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newPageServer 启动返回 page 的测试服务，encoding 不为空时按该编码压缩响应体；
+// 返回服务地址和累计发送的响应体字节数
+func newPageServer(t testing.TB, encoding string, page []byte) (string, *atomic.Int64) {
+	t.Helper()
+	body := compress(t, encoding, page)
+	header := strings.TrimPrefix(encoding, "raw-")
+	var sent atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header != "" {
+			if !strings.Contains(r.Header.Get("Accept-Encoding"), header) {
+				t.Errorf("请求没有声明支持 %s: Accept-Encoding = %q", header, r.Header.Get("Accept-Encoding"))
+			}
+			w.Header().Set("Content-Encoding", header)
+		}
+		n, _ := w.Write(body)
+		sent.Add(int64(n))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &sent
+}
+
+// withoutRateLimit 在测试期间关闭抓取限速
+func withoutRateLimit(t testing.TB) {
+	saved := RequestsPerSecond
+	RequestsPerSecond = 0
+	t.Cleanup(func() { RequestsPerSecond = saved })
+}
+
+func TestFetchCompressedPage(t *testing.T) {
+	withoutRateLimit(t)
+	page := testStatePage(20)
+	for _, encoding := range []string{"", "gzip", "deflate", "raw-deflate"} {
+		t.Run(cmp.Or(encoding, "identity"), func(t *testing.T) {
+			url, _ := newPageServer(t, encoding, page)
+			doc, err := fetchOnce(t.Context(), url)
+			if err != nil {
+				t.Fatalf("fetchOnce() 返回错误: %v", err)
+			}
+			if got := len(parseLocations(doc)); got != 20 {
+				t.Errorf("解压后解析出 %d 个地址，want 20", got)
+			}
+		})
+	}
+}
+
+// BenchmarkFetchStatePage 比较压缩与不压缩时抓取一个州页面传输的字节数 (wire-B/op)
+func BenchmarkFetchStatePage(b *testing.B) {
+	withoutRateLimit(b)
+	page := testStatePage(200)
+	for _, encoding := range []string{"", "gzip", "deflate"} {
+		b.Run(cmp.Or(encoding, "identity"), func(b *testing.B) {
+			url, sent := newPageServer(b, encoding, page)
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := fetchOnce(b.Context(), url); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(sent.Load())/float64(b.N), "wire-B/op")
+			b.ReportMetric(float64(len(page)), "page-B")
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"atmb/model"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 分页中途抓取失败时的处理方式
+const (
+	PageSkip      = "skip-page"  // 跳过失败的页面，保留其余页面的地址
+	PageFailState = "fail-state" // 放弃整个州，由调用方重新抓取
+	PageRetry     = "retry-page" // 重试失败的页面，仍然失败时跳过该页
+)
+
+// PaginationFailureMode 决定分页中途某一页抓取失败时的处理方式
+var PaginationFailureMode = PageSkip
+
+// pageRetries 是 retry-page 模式下单个页面的最大重试次数
+const pageRetries = 3
+
+// ErrIncompleteState 表示 fail-state 模式下某一页抓取失败，整个州的结果已被丢弃
+var ErrIncompleteState = errors.New("state pagination incomplete")
+
+// ValidatePaginationFailureMode 检查分页失败处理方式是否受支持
+func ValidatePaginationFailureMode(mode string) error {
+	switch mode {
+	case PageSkip, PageFailState, PageRetry:
+		return nil
+	}
+	return fmt.Errorf("不支持的分页失败处理方式: %s (可选 %s, %s, %s)", mode, PageSkip, PageFailState, PageRetry)
+}
+
+// MaxPages 是单个州最多抓取的页面数，防止分页链接循环时无限抓取
+var MaxPages = 50
+
+// paginationSelector 匹配分页控件中的页码链接和 "下一页" 链接
+const paginationSelector = `.pagination a[href], a[rel="next"][href], .next a[href], a.next[href]`
+
+// pageURLs 从页面的分页控件中收集尚未见过的页面的绝对地址，按页面上出现的顺序返回，
+// 并将它们加入 seen。current 是该页面自身的地址，用于解析相对链接。
+func pageURLs(doc *goquery.Document, current string, seen map[string]bool) []string {
+	base, err := url.Parse(current)
+	if err != nil {
+		return nil
+	}
+	seen[base.String()] = true
+	var pages []string
+	doc.Find(paginationSelector).Each(func(i int, s *goquery.Selection) {
+		ref, err := url.Parse(s.AttrOr("href", ""))
+		if err != nil {
+			return
+		}
+		target := base.ResolveReference(ref)
+		target.Fragment = ""
+		page := target.String()
+		if seen[page] {
+			return
+		}
+		seen[page] = true
+		pages = append(pages, page)
+	})
+	return pages
+}
+
+// fetchRemainingPages 从第一页的分页控件出发依次抓取其余页面。每抓取一页都会收集其中新出现的页面链接
+// (分页控件只显示部分页码或只有 "下一页" 链接时也能继续)，直到没有新的页面或达到 MaxPages。
+// 抓取失败的页面按 PaginationFailureMode 处理，并记录哪些页面成功、哪些失败。
+// 页码按抓取顺序从 2 开始计数，第一页由调用方抓取。
+func fetchRemainingPages(ctx context.Context, state string, first *goquery.Document, firstURL string) ([]model.Address, error) {
+	seen := make(map[string]bool)
+	queue := pageURLs(first, firstURL, seen)
+	if len(queue) == 0 {
+		return nil, nil
+	}
+
+	var addresses []model.Address
+	succeeded := []int{1}
+	var failed []int
+
+	for pageNum := 2; len(queue) > 0; pageNum++ {
+		if pageNum > MaxPages {
+			log.Printf("警告: %s 的页面数超过上限 %d，剩余 %d 个页面不再抓取。", state, MaxPages, len(queue))
+			break
+		}
+		page := queue[0]
+		queue = queue[1:]
+
+		doc, err := fetchStatePage(ctx, page)
+		if err != nil && PaginationFailureMode == PageRetry {
+			for retry := 1; retry <= pageRetries && err != nil && ctx.Err() == nil; retry++ {
+				log.Printf("抓取 %s 第 %d 页失败，正在重试 (%d/%d): %v", state, pageNum, retry, pageRetries, err)
+				if sleepContext(ctx, time.Duration(retry)*time.Second) == nil {
+					doc, err = fetchStatePage(ctx, page)
+				}
+			}
+		}
+		// 程序关闭或超时时不再抓取剩余页面
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			failed = append(failed, pageNum)
+			if PaginationFailureMode == PageFailState {
+				log.Printf("抓取 %s 第 %d 页失败，放弃整个州 (已成功的页面: %v): %v", state, pageNum, succeeded, err)
+				return nil, fmt.Errorf("%w: %s 第 %d 页: %v", ErrIncompleteState, state, pageNum, err)
+			}
+			log.Printf("抓取 %s 第 %d 页失败，跳过该页: %v", state, pageNum, err)
+			continue
+		}
+		succeeded = append(succeeded, pageNum)
+		addresses = append(addresses, parseLocations(doc)...)
+		queue = append(queue, pageURLs(doc, page, seen)...)
+	}
+
+	log.Printf("%s 共抓取 %d 页，成功的页面: %v，失败的页面: %v", state, len(succeeded)+len(failed), succeeded, failed)
+	return addresses, nil
+}
+
+// dedupeByLink 按 Link 去除重复的地址 (如最后一页重复了前一页的内容)，保留第一次出现的地址。
+// 没有链接的地址无法判断是否重复，全部保留。
+func dedupeByLink(addresses []model.Address) []model.Address {
+	seen := make(map[string]bool, len(addresses))
+	unique := addresses[:0]
+	for _, addr := range addresses {
+		if addr.Link != "" {
+			if seen[addr.Link] {
+				continue
+			}
+			seen[addr.Link] = true
+		}
+		unique = append(unique, addr)
+	}
+	return unique
+}
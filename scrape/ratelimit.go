@@ -0,0 +1,41 @@
+package scrape
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultRequestsPerSecond 是默认的抓取速率，对 anytimemailbox.com 保持礼貌，避免 IP 被封
+const DefaultRequestsPerSecond = 2
+
+// RequestsPerSecond 是所有抓取工作单元合计每秒最多发出的请求数，0 表示不限制
+var RequestsPerSecond float64 = DefaultRequestsPerSecond
+
+// limiter 由所有抓取请求共用，因此无论有多少个工作单元，总速率都不会超过 RequestsPerSecond
+var limiter rateLimiter
+
+// rateLimiter 按固定间隔放行请求，请求不会集中突发
+type rateLimiter struct {
+	mu   sync.Mutex
+	next time.Time // 下一个请求最早可以发出的时间
+}
+
+// Wait 为调用方预留下一个请求时间点，并阻塞到该时间点；ctx 被取消时提前返回 ctx 的错误
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if RequestsPerSecond <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / RequestsPerSecond)
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(interval)
+	l.mu.Unlock()
+
+	return sleepContext(ctx, wait)
+}
@@ -0,0 +1,70 @@
+package scrape
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//go:embed states.json
+var staticStatesJSON []byte
+
+// State 是州的显示名称与其 ATMB 地址页 slug (/l/usa/<slug>) 的对应关系，
+// 内置州列表和从网站获取的州列表都使用该结构
+type State struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// slugRe 是合法 slug 的格式：小写字母、数字和连字符
+var slugRe = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// LoadStaticStates 返回内置的 50 个州及领地列表，不需要访问网络
+func LoadStaticStates() ([]State, error) {
+	var states []State
+	if err := json.Unmarshal(staticStatesJSON, &states); err != nil {
+		return nil, fmt.Errorf("解析内置州列表失败: %w", err)
+	}
+	for _, s := range states {
+		if s.Name == "" || !slugRe.MatchString(s.Slug) {
+			return nil, fmt.Errorf("内置州列表中存在无效条目: %+v", s)
+		}
+	}
+	return states, nil
+}
+
+// StaticStateSlugs 返回内置州列表中按字母排序的 slug，可直接传给 GetStateDetail。
+// 用于首页改版或无法访问导致 GetState 失败时的兜底。
+func StaticStateSlugs() ([]string, error) {
+	states, err := LoadStaticStates()
+	if err != nil {
+		return nil, err
+	}
+	slugs := make([]string, len(states))
+	for i, s := range states {
+		slugs[i] = s.Slug
+	}
+	sort.Strings(slugs)
+	return slugs, nil
+}
+
+// statePathPrefix 是州地址页的路径前缀
+const statePathPrefix = "/l/usa/"
+
+// ParseStateSlug 校验用户提供的州 slug 并返回规范化后的 slug。
+// 既可以是 slug 本身 (如 new-york)，也可以是完整的地址页路径 (如 /l/usa/new-york)，
+// 或者单词之间以空格分隔的州名 (如 New York)。
+func ParseStateSlug(value string) (string, error) {
+	slug := strings.TrimSpace(value)
+	if i := strings.Index(slug, statePathPrefix); i >= 0 {
+		slug = slug[i+len(statePathPrefix):]
+	}
+	slug = strings.Join(strings.Fields(strings.ToLower(strings.Trim(slug, "/"))), "-")
+	if !slugRe.MatchString(slug) {
+		return "", fmt.Errorf("无效的州 %q，应为 %s<state> 中的 slug，如 california 或 new-york", value, statePathPrefix)
+	}
+	return slug, nil
+}
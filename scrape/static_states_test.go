@@ -0,0 +1,49 @@
+package scrape
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLoadStaticStates(t *testing.T) {
+	states, err := LoadStaticStates()
+	if err != nil {
+		t.Fatalf("LoadStaticStates() 返回错误: %v", err)
+	}
+	// 50 个州，加上华盛顿特区和海外领地
+	if len(states) < 51 {
+		t.Fatalf("内置州列表只有 %d 个州", len(states))
+	}
+
+	names := make(map[string]bool, len(states))
+	slugs := make(map[string]bool, len(states))
+	for _, s := range states {
+		if names[s.Name] || slugs[s.Slug] {
+			t.Errorf("内置州列表中重复出现 %+v", s)
+		}
+		names[s.Name], slugs[s.Slug] = true, true
+		// 内置的 slug 必须是 ParseStateSlug 认可的规范形式，才能直接用于 -states 和抓取
+		if got, err := ParseStateSlug(s.Slug); err != nil || got != s.Slug {
+			t.Errorf("ParseStateSlug(%q) = %q, %v，内置 slug 不是规范形式", s.Slug, got, err)
+		}
+	}
+	for _, slug := range []string{"california", "new-york", "texas", "district-of-columbia"} {
+		if !slugs[slug] {
+			t.Errorf("内置州列表缺少 %s", slug)
+		}
+	}
+}
+
+func TestStaticStateSlugs(t *testing.T) {
+	slugs, err := StaticStateSlugs()
+	if err != nil {
+		t.Fatalf("StaticStateSlugs() 返回错误: %v", err)
+	}
+	states, _ := LoadStaticStates()
+	if len(slugs) != len(states) {
+		t.Errorf("StaticStateSlugs() 返回 %d 个 slug，内置列表有 %d 个州", len(slugs), len(states))
+	}
+	if !slices.IsSorted(slugs) {
+		t.Errorf("StaticStateSlugs() 没有按字母排序: %v", slugs)
+	}
+}
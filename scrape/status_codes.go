@@ -0,0 +1,38 @@
+package scrape
+
+import (
+	"sort"
+	"sync"
+)
+
+// statusCodes 统计本次运行中从 anytimemailbox.com 收到的各个 HTTP 状态码的次数
+var statusCodes = struct {
+	sync.Mutex
+	counts map[int]int
+}{counts: map[int]int{}}
+
+// recordStatusCode 记录一次收到的 HTTP 状态码
+func recordStatusCode(code int) {
+	statusCodes.Lock()
+	defer statusCodes.Unlock()
+	statusCodes.counts[code]++
+}
+
+// StatusCodeCount 是某个 HTTP 状态码及其出现次数
+type StatusCodeCount struct {
+	Code  int
+	Count int
+}
+
+// StatusCodeCounts 按状态码升序返回本次运行中收到的 HTTP 状态码分布。
+// 403、429 明显增多通常说明请求被站点拦截，需要降低抓取频率或更换代理。
+func StatusCodeCounts() []StatusCodeCount {
+	statusCodes.Lock()
+	defer statusCodes.Unlock()
+	counts := make([]StatusCodeCount, 0, len(statusCodes.counts))
+	for code, count := range statusCodes.counts {
+		counts = append(counts, StatusCodeCount{Code: code, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Code < counts[j].Code })
+	return counts
+}
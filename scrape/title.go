@@ -0,0 +1,39 @@
+package scrape
+
+import "strings"
+
+// ParseTitles 为 true 时，GetStateDetail 会将卡片标题解析为地点名称和描述
+var ParseTitles bool
+
+// titleSeparators 是标题中分隔地点名称与描述的常见符号，按优先级排列
+var titleSeparators = []string{" - ", " – ", " — ", " | ", ": "}
+
+// ParseTitle 将 ATMB 卡片标题拆分为地点名称和描述，例如
+// "Los Angeles - Wilshire Blvd" 拆分为 "Los Angeles" 和 "Wilshire Blvd"，
+// "Miami (Brickell)" 拆分为 "Miami" 和 "Brickell"。
+// 无法识别结构时，地点名称为去除首尾空白的原始标题，描述为空。
+func ParseTitle(title string) (name, descriptor string) {
+	title = strings.Join(strings.Fields(title), " ")
+
+	for _, sep := range titleSeparators {
+		if before, after, found := strings.Cut(title, sep); found {
+			before, after = strings.TrimSpace(before), strings.TrimSpace(after)
+			if before != "" && after != "" {
+				return before, after
+			}
+		}
+	}
+
+	// 形如 "Name (Descriptor)" 的标题
+	if strings.HasSuffix(title, ")") {
+		if open := strings.LastIndex(title, "("); open > 0 {
+			before := strings.TrimSpace(title[:open])
+			inner := strings.TrimSpace(title[open+1 : len(title)-1])
+			if before != "" && inner != "" {
+				return before, inner
+			}
+		}
+	}
+
+	return title, ""
+}
@@ -0,0 +1,54 @@
+package scrape
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		title, name, descriptor string
+	}{
+		{title: "Los Angeles - Wilshire Blvd", name: "Los Angeles", descriptor: "Wilshire Blvd"},
+		{title: "Austin – Congress Ave", name: "Austin", descriptor: "Congress Ave"},
+		{title: "Denver — 17th St", name: "Denver", descriptor: "17th St"},
+		{title: "Seattle | Downtown", name: "Seattle", descriptor: "Downtown"},
+		{title: "Boston: Back Bay", name: "Boston", descriptor: "Back Bay"},
+		{title: "Miami (Brickell)", name: "Miami", descriptor: "Brickell"},
+		{title: "  New   York -  Midtown  ", name: "New York", descriptor: "Midtown"},
+		// 按优先级使用第一个分隔符，其余部分留在描述中
+		{title: "Portland - Pearl District (NW)", name: "Portland", descriptor: "Pearl District (NW)"},
+		{title: "Wilkes-Barre", name: "Wilkes-Barre"},
+		{title: "Chicago -", name: "Chicago -"},
+		{title: "(Downtown)", name: "(Downtown)"},
+		{title: "Reno ()", name: "Reno ()"},
+		{title: "  Phoenix  ", name: "Phoenix"},
+		{title: "", name: ""},
+	}
+	for _, tt := range tests {
+		name, descriptor := ParseTitle(tt.title)
+		if name != tt.name || descriptor != tt.descriptor {
+			t.Errorf("ParseTitle(%q) = %q, %q; want %q, %q", tt.title, name, descriptor, tt.name, tt.descriptor)
+		}
+	}
+}
+
+func TestParseStateDetailParsesTitles(t *testing.T) {
+	saved := ParseTitles
+	ParseTitles = true
+	t.Cleanup(func() { ParseTitles = saved })
+
+	f, err := os.Open(filepath.Join("testdata", "state_normal.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := ParseStateDetail(f, "state_normal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].LocationName != "Austin" || got[0].Descriptor != "Congress Ave" {
+		t.Errorf("ParseStateDetail() = %+v，want LocationName Austin, Descriptor Congress Ave", got)
+	}
+}
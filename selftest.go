@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"regexp"
+
+	"atmb/model"
+	"atmb/scrape"
+)
+
+var (
+	selfTestStateRe = regexp.MustCompile(`^[A-Z]{2}$`)
+	selfTestZipRe   = regexp.MustCompile(`^\d{5}$`)
+)
+
+// malformedFields 返回地址中缺失或格式错误的字段名
+func malformedFields(addr *model.Address) []string {
+	var bad []string
+	if addr.Title == "" {
+		bad = append(bad, "Title")
+	}
+	if addr.Street == "" {
+		bad = append(bad, "Street")
+	}
+	if addr.City == "" {
+		bad = append(bad, "City")
+	}
+	if !selfTestStateRe.MatchString(addr.State) {
+		bad = append(bad, "State")
+	}
+	if !selfTestZipRe.MatchString(addr.Zip) {
+		bad = append(bad, "Zip")
+	}
+	return bad
+}
+
+// runSelfTest 抓取一个已知州的页面并检查解析结果，用于在网站改版时及早发现选择器失效。
+// 至少解析出一个字段完整的地址时返回 0，否则输出诊断信息并返回 1。
+func runSelfTest(ctx context.Context, state string) int {
+	log.Printf("自检: 正在抓取并解析 %s ...", state)
+	addresses, err := scrape.GetStateDetail(ctx, state)
+	if err != nil {
+		log.Printf("自检失败: 无法获取 %s 的页面，请检查网络或站点状态: %v", state, err)
+		return 1
+	}
+	return checkParsedAddresses(state, addresses)
+}
+
+// runSelfTestHTML 用保存下来的州页面 (如浏览器 "另存为" 的 HTML) 代替实时抓取运行自检，
+// 不访问网络，适合在修改解析规则后用各种页面样本 (普通地址、Suite、PO Box、空页面等) 核对结果。
+// 返回值与 runSelfTest 相同。
+func runSelfTestHTML(filename, state string) int {
+	f, err := os.Open(filename)
+	if err != nil {
+		log.Printf("自检失败: 无法打开 %s: %v", filename, err)
+		return 1
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Println("runSelfTestHTML 文件退出错误: ", err)
+		}
+	}()
+
+	log.Printf("自检: 正在解析保存的页面 %s ...", filename)
+	addresses, err := scrape.ParseStateDetail(f, state)
+	if err != nil {
+		log.Printf("自检失败: 无法解析 %s: %v", filename, err)
+		return 1
+	}
+	for i := range addresses {
+		addr := &addresses[i]
+		log.Printf("自检: 第 %d 个地址: %s | %s | %s | %s, %s %s | %s",
+			i+1, addr.Title, addr.Street, addr.Secondary, addr.City, addr.State, addr.Zip, addr.Link)
+	}
+	return checkParsedAddresses(filename, addresses)
+}
+
+// checkParsedAddresses 检查解析出的地址是否字段完整，至少有一个完整的地址时返回 0，否则返回 1
+func checkParsedAddresses(source string, addresses []model.Address) int {
+	if len(addresses) == 0 {
+		log.Printf("自检失败: %s 页面中没有解析出任何地址，地址卡片选择器可能已失效。", source)
+		return 1
+	}
+
+	valid := 0
+	for i := range addresses {
+		bad := malformedFields(&addresses[i])
+		if len(bad) == 0 {
+			valid++
+			continue
+		}
+		log.Printf("自检: 第 %d 个地址字段不完整 %v: %+v", i+1, bad, addresses[i])
+	}
+
+	if valid == 0 {
+		log.Printf("自检失败: %s 的 %d 个地址均不完整，地址解析规则可能已失效。", source, len(addresses))
+		return 1
+	}
+	log.Printf("自检通过: %s 共解析出 %d 个地址，其中 %d 个字段完整。", source, len(addresses), valid)
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"atmb/scrape"
+)
+
+// Smarty SDK 的 HTTP 设置，与抓取 ATMB 使用的客户端相互独立
+var (
+	smartyTimeout  time.Duration
+	smartyMaxRetry int
+	smartyProxy    string
+	// smartyViaATMBProxy 为 true 时 Smarty 请求与抓取请求轮流使用同一组 -atmb-proxy 代理
+	smartyViaATMBProxy bool
+	// smartyBatchTimeout 是每次批量请求 (包括 SDK 内部的重试) 的期限，0 表示不限制
+	smartyBatchTimeout time.Duration
+	// smartyBatchSize 是每次批量请求最多包含的地址数量
+	smartyBatchSize int
+	// smartyHTTPClient 由 configureSmartyClient 创建，通过 pipeline.Config 交给所有 Smarty 客户端共用，以便复用连接
+	smartyHTTPClient *http.Client
+)
+
+// configureSmartyClient 按 -smarty-timeout、-smarty-proxy 和 -smarty-via-atmb-proxy 参数创建 Smarty 使用的 HTTP 客户端。
+// 未指定代理时沿用 HTTP_PROXY/HTTPS_PROXY 环境变量。
+func configureSmartyClient() error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if smartyViaATMBProxy {
+		if smartyProxy != "" {
+			return fmt.Errorf("-smarty-proxy 与 -smarty-via-atmb-proxy 不能同时使用")
+		}
+		if transport.Proxy = scrape.ProxyFunc(); transport.Proxy == nil {
+			return fmt.Errorf("-smarty-via-atmb-proxy 需要同时指定 -atmb-proxy")
+		}
+	}
+	if smartyProxy != "" {
+		proxy, err := url.Parse(smartyProxy)
+		if err != nil {
+			return fmt.Errorf("无效的代理地址 %s: %w", smartyProxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	smartyHTTPClient = &http.Client{Timeout: smartyTimeout, Transport: transport}
+	return nil
+}
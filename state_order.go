@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 州的分发顺序 (-state-order)
+const (
+	orderDiscovery = ""         // 保持获取州列表时的顺序 (网站和内置列表按字母排序，-states 按给定顺序)
+	orderAlpha     = "alpha"    // 按字母排序
+	orderExpected  = "expected" // 按预期地址数量从多到少，地址多的州优先处理
+	orderPriority  = "priority" // -state-priority 中列出的州按给定顺序优先，其余州按字母排序
+)
+
+// stateOrderFunc 返回州的分发顺序，不修改传入的切片。
+// 运行可能因查询额度耗尽而提前结束时，排在前面的州更有可能被完整处理。
+type stateOrderFunc func(states []string) []string
+
+// stateOrderKey 将州名或 slug 规范化为可以互相比较的键，如 "New York" 和 "new-york" 都得到 "new-york"
+func stateOrderKey(state string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(state, "-", " "))), "-")
+}
+
+// alphabeticalOrder 按字母排序
+func alphabeticalOrder(states []string) []string {
+	ordered := slices.Clone(states)
+	slices.Sort(ordered)
+	return ordered
+}
+
+// expectedCountOrder 按 counts (州名或 slug -> 预期地址数量) 从多到少排序，
+// 数量相同或没有预期数量 (视为 0) 的州按字母排序
+func expectedCountOrder(counts map[string]int) stateOrderFunc {
+	byKey := make(map[string]int, len(counts))
+	for state, n := range counts {
+		byKey[stateOrderKey(state)] = n
+	}
+	return func(states []string) []string {
+		ordered := alphabeticalOrder(states)
+		slices.SortStableFunc(ordered, func(a, b string) int {
+			na, _ := lookupState(byKey, a)
+			nb, _ := lookupState(byKey, b)
+			return nb - na
+		})
+		return ordered
+	}
+}
+
+// priorityOrder 将 priority 中列出的州按给定顺序排在最前面，其余州按字母排序排在后面
+func priorityOrder(priority []string) stateOrderFunc {
+	rank := make(map[string]int, len(priority))
+	for i, state := range priority {
+		if _, ok := rank[stateOrderKey(state)]; !ok {
+			rank[stateOrderKey(state)] = i
+		}
+	}
+	return func(states []string) []string {
+		ordered := alphabeticalOrder(states)
+		slices.SortStableFunc(ordered, func(a, b string) int {
+			ra, okA := rank[stateOrderKey(a)]
+			rb, okB := rank[stateOrderKey(b)]
+			switch {
+			case okA && okB:
+				return ra - rb
+			case okA:
+				return -1
+			case okB:
+				return 1
+			}
+			return 0
+		})
+		return ordered
+	}
+}
+
+// newStateOrder 按 -state-order 参数创建排序函数，保持原有顺序时返回 nil。
+// expected 使用 -expect 文件中的预期数量，没有时使用 -min-per-state-file 中的最低数量。
+func newStateOrder(order string, priority []string) (stateOrderFunc, error) {
+	switch order {
+	case orderDiscovery:
+		return nil, nil
+	case orderAlpha:
+		return alphabeticalOrder, nil
+	case orderExpected:
+		counts := expectedCounts
+		if counts == nil {
+			counts = threshold.perState
+		}
+		if counts == nil {
+			return nil, fmt.Errorf("%s 需要通过 -expect 或 -min-per-state-file 提供各州的预期地址数量", orderExpected)
+		}
+		return expectedCountOrder(counts), nil
+	case orderPriority:
+		if len(priority) == 0 {
+			return nil, fmt.Errorf("%s 需要通过 -state-priority 指定优先处理的州", orderPriority)
+		}
+		return priorityOrder(priority), nil
+	}
+	return nil, fmt.Errorf("不支持的州顺序 %q (可选 %s, %s, %s)", order, orderAlpha, orderExpected, orderPriority)
+}
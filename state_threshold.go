@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"atmb/pipeline"
+)
+
+// stateThreshold 描述每个州至少应抓取到的地址数量，用于发现不完整的抓取
+type stateThreshold struct {
+	min      int            // 全局最低数量，0 表示不检查
+	perState map[string]int // 按州 (stateOrderKey 规范化后的州名或 slug) 指定的最低数量，优先于 min
+	requeue  int            // 数量不足时重新抓取该州的次数
+}
+
+// loadStateBaseline 读取形如 {"New York": 50} 的 JSON 文件 (键也可以是 slug，如 new-york)，
+// 返回按 stateOrderKey 规范化后的州索引的数量
+func loadStateBaseline(filename string) (map[string]int, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取基线文件失败: %w", err)
+	}
+	var raw map[string]int
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("解析基线文件失败: %w", err)
+	}
+	baseline := make(map[string]int, len(raw))
+	for state, count := range raw {
+		baseline[stateOrderKey(state)] = count
+	}
+	return baseline, nil
+}
+
+// expected 返回州的最低地址数量，0 表示不检查
+func (t *stateThreshold) expected(state string) int {
+	if n, ok := lookupState(t.perState, state); ok {
+		return n
+	}
+	return t.min
+}
+
+// isShort 判断抓取到的地址数量是否低于该州的最低数量
+func (t *stateThreshold) isShort(state string, count int) bool {
+	return count < t.expected(state)
+}
+
+// forStates 返回交给 pipeline 的阈值，按州名或 slug 指定的最低数量被解析为 states 中各州 slug 的数量
+func (t *stateThreshold) forStates(states []string) pipeline.StateThreshold {
+	perState := make(map[string]int)
+	for _, state := range states {
+		if n, ok := lookupState(t.perState, state); ok {
+			perState[state] = n
+		}
+	}
+	return pipeline.StateThreshold{Min: t.min, PerState: perState, Requeue: t.requeue}
+}
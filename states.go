@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"atmb/scrape"
+)
+
+// splitList 将逗号分隔的参数值拆分为去除首尾空白的非空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// stateNames 是州 slug 到显示名称 (如 new-york -> New York) 的对应关系，获取州列表时填充，
+// 之后只读。-skip-states、-expect 和 -min-per-state-file 中的州既可以写 slug，也可以写显示名称。
+var stateNames = map[string]string{}
+
+// registerStateNames 记录州的显示名称，返回它们的 slug (保持原有顺序)
+func registerStateNames(states []scrape.State) []string {
+	slugs := make([]string, len(states))
+	for i, state := range states {
+		stateNames[state.Slug] = state.Name
+		slugs[i] = state.Slug
+	}
+	return slugs
+}
+
+// stateKeys 返回州 slug 及其显示名称经 stateOrderKey 规范化后的键 (去掉重复)
+func stateKeys(state string) []string {
+	keys := []string{stateOrderKey(state)}
+	if name, ok := stateNames[strings.TrimSpace(state)]; ok {
+		if key := stateOrderKey(name); key != keys[0] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// lookupState 在以 stateOrderKey 为键的 counts 中查找州，slug 和显示名称都可以匹配
+func lookupState(counts map[string]int, state string) (int, bool) {
+	for _, key := range stateKeys(state) {
+		if n, ok := counts[key]; ok {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// skipStates 从州列表中移除 skip 中列出的州 (州名或 slug，不区分大小写)，保持原有顺序
+func skipStates(states []string, skip []string) []string {
+	if len(skip) == 0 {
+		return states
+	}
+	skipSet := make(map[string]bool, len(skip))
+	for _, state := range skip {
+		skipSet[stateOrderKey(state)] = true
+	}
+
+	kept := make([]string, 0, len(states))
+	for _, state := range states {
+		if slices.ContainsFunc(stateKeys(state), func(key string) bool { return skipSet[key] }) {
+			log.Printf("根据 -skip-states 跳过州: %s", state)
+			continue
+		}
+		kept = append(kept, state)
+	}
+	return kept
+}
+
+// loadStateList 读取 -states 参数和 -states-file 文件中指定的州，校验并去重后返回 slug 列表。
+// 文件中每行一个州，空行和以 # 开头的行会被忽略。
+func loadStateList(value, filename string) ([]string, error) {
+	entries := splitList(value)
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("打开州列表文件失败: %w", err)
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("读取州列表文件 %s 失败: %w", filename, err)
+		}
+	}
+
+	seen := make(map[string]bool, len(entries))
+	states := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		slug, err := scrape.ParseStateSlug(entry)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[slug] {
+			seen[slug] = true
+			states = append(states, slug)
+		}
+	}
+	return states, nil
+}
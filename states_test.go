@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"atmb/scrape"
+)
+
+// withStateNames 在测试期间使用 states 作为已知的州名，测试结束后恢复
+func withStateNames(t *testing.T, states ...scrape.State) {
+	t.Helper()
+	saved := stateNames
+	stateNames = map[string]string{}
+	registerStateNames(states)
+	t.Cleanup(func() { stateNames = saved })
+}
+
+func TestSkipStates(t *testing.T) {
+	withStateNames(t,
+		scrape.State{Name: "New York", Slug: "new-york"},
+		scrape.State{Name: "Washington, D.C.", Slug: "district-of-columbia"},
+	)
+	states := []string{"california", "new-york", "district-of-columbia", "north-carolina"}
+	got := skipStates(states, []string{"New York", "washington, d.c.", "North-Carolina"})
+	want := []string{"california"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("skipStates() = %v, want %v", got, want)
+	}
+}
+
+func TestStateThresholdExpected(t *testing.T) {
+	withStateNames(t, scrape.State{Name: "Washington, D.C.", Slug: "district-of-columbia"})
+	th := stateThreshold{min: 5, perState: map[string]int{
+		stateOrderKey("New York"):         50,
+		stateOrderKey("Washington, D.C."): 20,
+		stateOrderKey("texas"):            30,
+	}}
+	for state, want := range map[string]int{
+		"new-york":             50,
+		"district-of-columbia": 20,
+		"texas":                30,
+		"ohio":                 5,
+	} {
+		if got := th.expected(state); got != want {
+			t.Errorf("expected(%q) = %d, want %d", state, got, want)
+		}
+	}
+}
+
+func TestStateCountsMatchesNamesAndSlugs(t *testing.T) {
+	withStateNames(t, scrape.State{Name: "Washington, D.C.", Slug: "district-of-columbia"})
+	counts := &stateCounts{counts: map[string]int{}}
+	counts.Record("new-york", 12)
+	counts.Record("district-of-columbia", 3)
+
+	for _, state := range []string{"New York", "new-york", "Washington, D.C.", "district-of-columbia"} {
+		if _, ok := counts.get(state); !ok {
+			t.Errorf("get(%q) 没有找到已抓取的州", state)
+		}
+	}
+	if _, ok := counts.get("ohio"); ok {
+		t.Error("get(\"ohio\") 不应找到没有抓取的州")
+	}
+}
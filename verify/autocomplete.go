@@ -0,0 +1,41 @@
+package verify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"atmb/model"
+
+	autocomplete "github.com/smartystreets/smartystreets-go-sdk/us-autocomplete-pro-api"
+)
+
+// Suggest 使用 Smarty US Autocomplete Pro API 按街道、城市和州查询建议地址，
+// 返回排名第一的建议，没有任何建议时返回空字符串。
+// 用于在地址严格验证失败时给出可能的正确写法，供人工核对。
+func Suggest(ctx context.Context, client *autocomplete.Client, addr *model.Address) (string, error) {
+	lookup := &autocomplete.Lookup{
+		Search:     addr.Street,
+		MaxResults: 1,
+	}
+	if addr.City != "" {
+		lookup.CityFilter = []string{addr.City}
+	}
+	if addr.State != "" {
+		lookup.StateFilter = []string{addr.State}
+	}
+
+	if err := client.SendLookupWithContext(ctx, lookup); err != nil {
+		return "", err
+	}
+	if len(lookup.Results) == 0 || lookup.Results[0] == nil {
+		return "", nil
+	}
+
+	top := lookup.Results[0]
+	street := top.StreetLine
+	if top.Secondary != "" {
+		street += " " + top.Secondary
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s, %s, %s %s", street, top.City, top.State, top.ZIPCode)), nil
+}
@@ -0,0 +1,88 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	sdk "github.com/smartystreets/smartystreets-go-sdk"
+)
+
+// ErrorCategory 是验证失败的错误类别，用于统计和决定重试策略
+type ErrorCategory string
+
+const (
+	CategoryNetwork           ErrorCategory = "network"
+	CategoryTimeout           ErrorCategory = "timeout"
+	CategoryRateLimit         ErrorCategory = "rate-limit"
+	CategoryServerError       ErrorCategory = "server-error"
+	CategoryInvalidCredential ErrorCategory = "invalid-credential"
+	CategoryUnknownAddress    ErrorCategory = "unknown-address"
+	CategoryOther             ErrorCategory = "other"
+)
+
+// Categories 按固定顺序列出所有错误类别，便于输出统计
+var Categories = []ErrorCategory{
+	CategoryNetwork,
+	CategoryTimeout,
+	CategoryRateLimit,
+	CategoryServerError,
+	CategoryInvalidCredential,
+	CategoryUnknownAddress,
+	CategoryOther,
+}
+
+// ErrAuthentication 表示 Smarty 拒绝了凭证 (401/402/403)，需要换用其他凭证
+var ErrAuthentication = errors.New("smarty authentication failed")
+
+// ErrTransient 表示超时、网络故障、限流或 Smarty 服务端错误 (5xx)，可以使用同一凭证重试
+var ErrTransient = errors.New("smarty transient error")
+
+// wrapRequestError 按类别为请求错误包装 ErrAuthentication 或 ErrTransient，
+// 调用方可以用 errors.Is 区分，原始错误仍然可以通过 errors.As 取得
+func wrapRequestError(err error) error {
+	switch Classify(err) {
+	case CategoryInvalidCredential:
+		return fmt.Errorf("%w: %w", ErrAuthentication, err)
+	case CategoryNetwork, CategoryTimeout, CategoryRateLimit, CategoryServerError:
+		return fmt.Errorf("%w: %w", ErrTransient, err)
+	}
+	return err
+}
+
+// Classify 根据 Smarty SDK 返回的错误判断其类别
+func Classify(err error) ErrorCategory {
+	if errors.Is(err, ErrUnknownAddress) {
+		return CategoryUnknownAddress
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CategoryTimeout
+	}
+
+	var statusErr *sdk.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode() {
+		case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden:
+			return CategoryInvalidCredential
+		case http.StatusTooManyRequests:
+			return CategoryRateLimit
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return CategoryTimeout
+		}
+		if statusErr.StatusCode() >= http.StatusInternalServerError {
+			return CategoryServerError
+		}
+		return CategoryOther
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return CategoryTimeout
+		}
+		return CategoryNetwork
+	}
+	return CategoryOther
+}
@@ -0,0 +1,129 @@
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+
+	sdk "github.com/smartystreets/smartystreets-go-sdk"
+)
+
+// statusError 返回 SDK 在收到 code 状态码时返回的错误
+func statusError(code int) error {
+	return fmt.Errorf("send batch: %w", sdk.NewHTTPStatusError(code, nil))
+}
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{"连接失败", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, CategoryNetwork},
+		{"context 到期", fmt.Errorf("post: %w", context.DeadlineExceeded), CategoryTimeout},
+		{"网络超时", &net.DNSError{Err: "i/o timeout", IsTimeout: true}, CategoryTimeout},
+		{"408", statusError(http.StatusRequestTimeout), CategoryTimeout},
+		{"504", statusError(http.StatusGatewayTimeout), CategoryTimeout},
+		{"429", statusError(http.StatusTooManyRequests), CategoryRateLimit},
+		{"500", statusError(http.StatusInternalServerError), CategoryServerError},
+		{"503", statusError(http.StatusServiceUnavailable), CategoryServerError},
+		{"401", statusError(http.StatusUnauthorized), CategoryInvalidCredential},
+		{"402", statusError(http.StatusPaymentRequired), CategoryInvalidCredential},
+		{"403", statusError(http.StatusForbidden), CategoryInvalidCredential},
+		{"地址未知", fmt.Errorf("1 Main St: %w", ErrUnknownAddress), CategoryUnknownAddress},
+		{"其他状态码", statusError(http.StatusBadRequest), CategoryOther},
+		{"其他错误", errors.New("boom"), CategoryOther},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyCoversAllCategories(t *testing.T) {
+	errs := map[ErrorCategory]error{
+		CategoryNetwork:           &net.OpError{Op: "dial", Err: errors.New("connection refused")},
+		CategoryTimeout:           context.DeadlineExceeded,
+		CategoryRateLimit:         statusError(http.StatusTooManyRequests),
+		CategoryServerError:       statusError(http.StatusBadGateway),
+		CategoryInvalidCredential: statusError(http.StatusUnauthorized),
+		CategoryUnknownAddress:    ErrUnknownAddress,
+		CategoryOther:             errors.New("boom"),
+	}
+	for _, category := range Categories {
+		err, ok := errs[category]
+		if !ok {
+			t.Errorf("类别 %q 没有对应的测试错误", category)
+			continue
+		}
+		if got := Classify(err); got != category {
+			t.Errorf("Classify(%v) = %q, want %q", err, got, category)
+		}
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		want RetryAction
+	}{
+		{"地址未知", fmt.Errorf("1 Main St: %w", ErrUnknownAddress), Fail},
+		{"没有回放记录", fmt.Errorf("replay: %w", ErrNoRecording), Fail},
+		{"关闭时取消", fmt.Errorf("post: %w", context.Canceled), Fail},
+		{"认证失败", wrapRequestError(statusError(http.StatusUnauthorized)), RotateCredential},
+		{"额度用尽", wrapRequestError(statusError(http.StatusPaymentRequired)), RotateCredential},
+		{"超时", wrapRequestError(context.DeadlineExceeded), Retry},
+		{"限流", wrapRequestError(statusError(http.StatusTooManyRequests)), Retry},
+		{"服务端错误", wrapRequestError(statusError(http.StatusServiceUnavailable)), Retry},
+		{"网络故障", wrapRequestError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}), Retry},
+		{"其他错误", errors.New("boom"), Retry},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (DefaultRetryPolicy{}).Classify(tt.err); got != tt.want {
+				t.Errorf("Classify(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrapRequestError(t *testing.T) {
+	for _, tt := range []struct {
+		err             error
+		auth, transient bool
+	}{
+		{statusError(http.StatusForbidden), true, false},
+		{context.DeadlineExceeded, false, true},
+		{statusError(http.StatusTooManyRequests), false, true},
+		{statusError(http.StatusInternalServerError), false, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, false, true},
+		{statusError(http.StatusBadRequest), false, false},
+	} {
+		err := wrapRequestError(tt.err)
+		if errors.Is(err, ErrAuthentication) != tt.auth || errors.Is(err, ErrTransient) != tt.transient {
+			t.Errorf("wrapRequestError(%v) = %v，want ErrAuthentication %v, ErrTransient %v", tt.err, err, tt.auth, tt.transient)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("wrapRequestError(%v) 丢失了原始错误", tt.err)
+		}
+	}
+}
+
+func TestRetryActionString(t *testing.T) {
+	for action, want := range map[RetryAction]string{
+		Retry:            "retry",
+		RotateCredential: "rotate-credential",
+		Fail:             "fail",
+		Fatal:            "fatal",
+		RetryAction(99):  "unknown",
+	} {
+		if got := action.String(); got != want {
+			t.Errorf("RetryAction(%d).String() = %q, want %q", int(action), got, want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package verify
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyStats 收集 Smarty 请求的耗时，可被多个工作单元并发使用
+type LatencyStats struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+}
+
+// LatencySummary 是耗时的汇总统计
+type LatencySummary struct {
+	Count         int
+	Min, Max      time.Duration
+	P50, P95, Avg time.Duration
+}
+
+// Record 记录一次请求的耗时
+func (s *LatencyStats) Record(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.samples = append(s.samples, d)
+}
+
+// Summary 计算目前为止所有请求的耗时统计
+func (s *LatencyStats) Summary() LatencySummary {
+	s.mutex.Lock()
+	sorted := make([]time.Duration, len(s.samples))
+	copy(sorted, s.samples)
+	s.mutex.Unlock()
+
+	if len(sorted) == 0 {
+		return LatencySummary{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	return LatencySummary{
+		Count: len(sorted),
+		Min:   sorted[0],
+		Max:   sorted[len(sorted)-1],
+		P50:   percentile(sorted, 0.50),
+		P95:   percentile(sorted, 0.95),
+		Avg:   total / time.Duration(len(sorted)),
+	}
+}
+
+// percentile 使用最近秩法计算已排序样本的百分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// Histogram 按 bounds (从小到大) 统计目前为止所有请求的耗时分布：cumulative[i] 是耗时不超过 bounds[i] 的请求数，
+// 同时返回耗时总和和请求总数，用于导出 Prometheus 直方图
+func (s *LatencyStats) Histogram(bounds []time.Duration) (cumulative []int, sum time.Duration, count int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cumulative = make([]int, len(bounds))
+	for _, d := range s.samples {
+		sum += d
+		for i, bound := range bounds {
+			if d <= bound {
+				cumulative[i]++
+			}
+		}
+	}
+	return cumulative, sum, len(s.samples)
+}
@@ -0,0 +1,55 @@
+package verify
+
+import (
+	"context"
+	"errors"
+)
+
+// RetryAction 是验证失败后工作单元应采取的动作
+type RetryAction int
+
+const (
+	// Retry 使用同一凭证重试
+	Retry RetryAction = iota
+	// RotateCredential 将当前凭证标记为失效，换用下一组凭证重试
+	RotateCredential
+	// Fail 放弃该地址，将其记为失败任务
+	Fail
+	// Fatal 放弃该地址并停止整个处理流程
+	Fatal
+)
+
+func (a RetryAction) String() string {
+	switch a {
+	case Retry:
+		return "retry"
+	case RotateCredential:
+		return "rotate-credential"
+	case Fail:
+		return "fail"
+	case Fatal:
+		return "fatal"
+	}
+	return "unknown"
+}
+
+// RetryPolicy 决定验证失败时应如何处理，可以替换为自定义实现
+type RetryPolicy interface {
+	Classify(err error) RetryAction
+}
+
+// DefaultRetryPolicy 是默认的重试策略：
+// 地址未知、没有回放记录或请求因关闭而被取消时直接放弃；凭证认证失败时换用下一组凭证重试；
+// 超时、网络故障、5xx 等其他错误使用同一凭证重试，避免临时故障白白消耗凭证。
+type DefaultRetryPolicy struct{}
+
+// Classify 实现 RetryPolicy 接口
+func (DefaultRetryPolicy) Classify(err error) RetryAction {
+	if errors.Is(err, ErrUnknownAddress) || errors.Is(err, ErrNoRecording) || errors.Is(err, context.Canceled) {
+		return Fail
+	}
+	if errors.Is(err, ErrAuthentication) {
+		return RotateCredential
+	}
+	return Retry
+}
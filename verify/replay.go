@@ -0,0 +1,91 @@
+package verify
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"atmb/model"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+)
+
+// ErrNoRecording 表示回放目录中没有该地址对应的响应记录
+var ErrNoRecording = errors.New("no recorded smarty response")
+
+// smartyRecording 是保存到磁盘的单个地址的 Smarty 响应
+type smartyRecording struct {
+	Street    string              `json:"street"`
+	Secondary string              `json:"secondary,omitempty"`
+	City      string              `json:"city"`
+	State     string              `json:"state"`
+	Zip       string              `json:"zip"`
+	Results   []*street.Candidate `json:"results"`
+}
+
+// recordingPath 根据地址生成稳定的记录文件路径。没有二级地址时路径与加入 Secondary 之前相同，旧的记录仍然可用。
+func recordingPath(dir string, addr *model.Address) string {
+	street := addr.Street
+	if addr.Secondary != "" {
+		street += " " + addr.Secondary
+	}
+	key := strings.ToUpper(strings.Join([]string{street, addr.City, addr.State, addr.Zip}, "|"))
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// recordSmartyResponse 将单个地址的 Smarty 响应保存到 dir 目录
+func recordSmartyResponse(dir string, addr *model.Address, results []*street.Candidate) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建记录目录失败: %w", err)
+	}
+	rec := smartyRecording{
+		Street:    addr.Street,
+		Secondary: addr.Secondary,
+		City:      addr.City,
+		State:     addr.State,
+		Zip:       addr.Zip,
+		Results:   results,
+	}
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("格式化 Smarty 响应失败: %w", err)
+	}
+	if err := os.WriteFile(recordingPath(dir, addr), data, 0644); err != nil {
+		return fmt.Errorf("写入 Smarty 响应记录失败: %w", err)
+	}
+	return nil
+}
+
+// ReplayVerifier 从 Dir 目录读取 SmartyVerifier 保存的响应代替真实的 API 调用，
+// 结果的处理方式与 SmartyInfo 完全一致。
+type ReplayVerifier struct {
+	Dir string
+}
+
+// Verify 实现 AddressVerifier 接口
+func (v ReplayVerifier) Verify(ctx context.Context, addr *model.Address) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(recordingPath(v.Dir, addr))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ErrNoRecording
+		}
+		return fmt.Errorf("读取 Smarty 响应记录失败: %w", err)
+	}
+
+	var rec smartyRecording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return fmt.Errorf("解析 Smarty 响应记录失败: %w", err)
+	}
+
+	return applyRecord(rec.Results, addr)
+}
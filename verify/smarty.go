@@ -0,0 +1,270 @@
+// Package verify 负责通过 Smarty API 验证地址并补充 CMRA、RDI 等信息。
+package verify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"atmb/model"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+)
+
+var ErrUnknownAddress = errors.New("unknown address")
+
+// AddressVerifier 验证单个地址，成功时将验证结果写回地址
+// ctx 被取消时，正在进行的请求会被中止并返回 ctx 的错误
+type AddressVerifier interface {
+	Verify(ctx context.Context, addr *model.Address) error
+}
+
+// SmartyVerifier 使用 Smarty US Street API 验证地址
+type SmartyVerifier struct {
+	Client *street.Client
+	// RecordDir 不为空时，每次 Smarty 响应都会被保存到该目录，供 ReplayVerifier 回放
+	RecordDir string
+	// Latency 不为空时，记录每次请求的耗时
+	Latency *LatencyStats
+	// SlowThreshold 大于 0 时，耗时超过该值的请求会被单独记录日志
+	SlowThreshold time.Duration
+	// MatchChain 是依次尝试的匹配策略，为空时只使用 strict。
+	// 地址在某一策略下未知时继续尝试下一个策略，每次尝试都是一次独立的 Smarty 查询。
+	MatchChain []street.MatchStrategy
+	// MaxCandidates 是每个地址最多返回的候选地址数量 (1-MaxCandidatesLimit)，0 表示 1。
+	// 大于 1 时，歧义地址会返回多个候选，候选数量记录在 Address.Candidates 中。
+	MaxCandidates int
+	// BatchTimeout 大于 0 时是每次批量请求 (包括 SDK 内部的重试) 的期限，
+	// 连接卡住的请求到期后以超时错误返回，由调用方按重试策略处理
+	BatchTimeout time.Duration
+}
+
+// MaxCandidatesLimit 是 Smarty 允许的单个地址最多候选数量
+const MaxCandidatesLimit = 10
+
+// MatchUnverified 是所有匹配策略都失败时记录的 MatchTier
+const MatchUnverified = "unverified"
+
+// ParseMatchChain 解析逗号分隔的匹配策略列表，如 "strict,enhanced"
+func ParseMatchChain(s string) ([]street.MatchStrategy, error) {
+	var chain []street.MatchStrategy
+	for _, part := range strings.Split(s, ",") {
+		tier := street.MatchStrategy(strings.ToLower(strings.TrimSpace(part)))
+		switch tier {
+		case "":
+			continue
+		case street.MatchStrict, street.MatchEnhanced, street.MatchInvalid:
+			chain = append(chain, tier)
+		default:
+			return nil, fmt.Errorf("不支持的匹配策略: %s (可选 %s, %s, %s)", part, street.MatchStrict, street.MatchEnhanced, street.MatchInvalid)
+		}
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("匹配策略列表为空")
+	}
+	return chain, nil
+}
+
+// MaxBatchSize 是 Smarty 单次批量请求允许的最大地址数量
+const MaxBatchSize = street.MaxBatchSize
+
+// Verify 实现 AddressVerifier 接口，按 MatchChain 依次尝试各个匹配策略，
+// 成功时将使用的策略记录到 addr.MatchTier。
+func (v SmartyVerifier) Verify(ctx context.Context, addr *model.Address) error {
+	return v.VerifyBatch(ctx, []*model.Address{addr})[0]
+}
+
+// VerifyBatch 按 MatchChain 依次验证多个地址，返回与 addrs 一一对应的错误。
+// 每个匹配策略下，尚未验证成功的地址每 MaxBatchSize 个合并为一次请求。
+// 批次中某个地址未知只影响该地址；请求本身失败时，该批次的所有地址都返回这个错误，
+// 认证失败的错误包装了 ErrAuthentication，可以重试的错误包装了 ErrTransient。
+func (v SmartyVerifier) VerifyBatch(ctx context.Context, addrs []*model.Address) []error {
+	errs, _ := v.VerifyBatchLookups(ctx, addrs)
+	return errs
+}
+
+// chain 返回实际使用的匹配策略，MatchChain 为空时只使用 strict
+func (v SmartyVerifier) chain() []street.MatchStrategy {
+	if len(v.MatchChain) == 0 {
+		return []street.MatchStrategy{street.MatchStrict}
+	}
+	return v.MatchChain
+}
+
+// LookupsPerAddress 返回验证一个地址最多需要的 Smarty 查询次数，即匹配策略的数量。
+// 调用方可以按该值为每个地址预留查询预算和凭证额度，再按 VerifyBatchLookups 的返回值归还未用的部分。
+func (v SmartyVerifier) LookupsPerAddress() int {
+	return len(v.chain())
+}
+
+// VerifyBatchLookups 与 VerifyBatch 相同，另外返回实际发送给 Smarty 的查询次数：
+// 每个匹配策略下发送的每个地址计一次，请求失败的地址同样计入 (无法确认 Smarty 是否已经计费)。
+func (v SmartyVerifier) VerifyBatchLookups(ctx context.Context, addrs []*model.Address) ([]error, int) {
+	chain := v.chain()
+	lookups := 0
+
+	errs := make([]error, len(addrs))
+	// pending 是在当前匹配策略下仍需验证的地址序号
+	pending := make([]int, len(addrs))
+	for i := range addrs {
+		pending[i] = i
+	}
+	for _, tier := range chain {
+		var unknown []int
+		for start := 0; start < len(pending); start += MaxBatchSize {
+			chunk := pending[start:min(start+MaxBatchSize, len(pending))]
+			batch := make([]*model.Address, len(chunk))
+			for j, i := range chunk {
+				batch[j] = addrs[i]
+			}
+			lookups += len(batch)
+			for j, err := range v.verifyTier(ctx, batch, tier) {
+				i := chunk[j]
+				errs[i] = err
+				if err == nil {
+					addrs[i].MatchTier = string(tier)
+				} else if errors.Is(err, ErrUnknownAddress) {
+					if len(chain) > 1 {
+						log.Printf("匹配策略 %s 未找到地址: %s, %s", tier, addrs[i].Street, addrs[i].City)
+					}
+					unknown = append(unknown, i)
+				}
+			}
+		}
+		pending = unknown
+	}
+	for _, i := range pending {
+		addrs[i].MatchTier = MatchUnverified
+	}
+	return errs, lookups
+}
+
+// verifyTier 使用指定的匹配策略在一次批量请求中验证最多 MaxBatchSize 个地址
+func (v SmartyVerifier) verifyTier(ctx context.Context, addrs []*model.Address, tier street.MatchStrategy) []error {
+	errs := make([]error, len(addrs))
+
+	batch := street.NewBatch()
+	for i, a := range addrs {
+		lookup := newLookup(a, i, v.MaxCandidates)
+		lookup.MatchStrategy = tier
+		batch.Append(lookup)
+	}
+
+	if v.BatchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.BatchTimeout)
+		defer cancel()
+	}
+	start := time.Now()
+	err := v.Client.SendBatchWithContext(ctx, batch)
+	elapsed := time.Since(start)
+	if v.Latency != nil {
+		v.Latency.Record(elapsed)
+	}
+	if v.SlowThreshold > 0 && elapsed > v.SlowThreshold {
+		log.Printf("Smarty 请求耗时 %v，超过阈值 %v: %s, %s (批次共 %d 个地址)", elapsed, v.SlowThreshold, addrs[0].Street, addrs[0].City, len(addrs))
+	}
+	if err != nil {
+		log.Println("发送请求失败: ", err)
+		err = wrapRequestError(err)
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	// 批量请求成功并不代表其中每一条记录都成功，需要逐条检查
+	for i, results := range candidatesByInput(batch, len(addrs)) {
+		if v.RecordDir != "" {
+			if err := recordSmartyResponse(v.RecordDir, addrs[i], results); err != nil {
+				log.Println("保存 Smarty 响应失败: ", err)
+			}
+		}
+		errs[i] = applyRecord(results, addrs[i])
+	}
+
+	return errs
+}
+
+// SmartyInfo 使用给定的客户端验证单个地址，ctx 被取消时中止请求。
+// 返回的错误可以用 errors.Is 与 ErrUnknownAddress、ErrAuthentication 和 ErrTransient 比较。
+func SmartyInfo(ctx context.Context, client *street.Client, addr *model.Address) error {
+	return SmartyVerifier{Client: client}.Verify(ctx, addr)
+}
+
+// SmartyInfoBatch 使用给定的客户端批量验证多个地址，每 MaxBatchSize 个地址合并为一次请求。
+// 返回与 addrs 一一对应的错误，某个地址未知不会影响同一批次中的其他地址。
+func SmartyInfoBatch(ctx context.Context, client *street.Client, addrs []*model.Address) []error {
+	return SmartyVerifier{Client: client}.VerifyBatch(ctx, addrs)
+}
+
+// newLookup 为地址创建最多返回 maxCandidates 个候选的查询，InputID 设为地址在批次中的序号，
+// Smarty 会在每个候选结果中原样返回该值，用于将结果映射回对应的地址。
+func newLookup(addr *model.Address, index, maxCandidates int) *street.Lookup {
+	return &street.Lookup{
+		Street:        addr.Street,
+		Secondary:     addr.Secondary,
+		City:          addr.City,
+		State:         addr.State,
+		ZIPCode:       addr.Zip,
+		InputID:       strconv.Itoa(index),
+		MaxCandidates: max(maxCandidates, 1),
+	}
+}
+
+// candidatesByInput 按候选结果携带的 InputID 将批量响应映射回批次中的 n 个地址，
+// 不依赖响应记录的顺序；Smarty 重新排序或遗漏某些记录时也能正确对应。
+// InputID 缺失或无法识别时退回使用 InputIndex。
+func candidatesByInput(batch *street.Batch, n int) [][]*street.Candidate {
+	byInput := make([][]*street.Candidate, n)
+	for _, record := range batch.Records() {
+		for _, candidate := range record.Results {
+			if candidate == nil {
+				continue
+			}
+			index, err := strconv.Atoi(candidate.InputID)
+			if err != nil {
+				index = candidate.InputIndex
+			}
+			if index < 0 || index >= n {
+				log.Printf("忽略无法对应到输入地址的候选结果 (InputID=%q, InputIndex=%d)", candidate.InputID, candidate.InputIndex)
+				continue
+			}
+			byInput[index] = append(byInput[index], candidate)
+		}
+	}
+	return byInput
+}
+
+// applyRecord 检查批量响应中单条记录的状态，成功时将结果写回地址。
+// 单条记录的失败只影响对应的地址，不会影响同一批次中的其他地址。
+func applyRecord(results []*street.Candidate, addr *model.Address) error {
+	if len(results) == 0 {
+		log.Println("未找到匹配的地址: ", addr.Street, addr.City, addr.State, addr.Zip)
+		return ErrUnknownAddress
+	}
+
+	candidate := results[0]
+	if candidate == nil {
+		log.Println("返回的候选地址为空: ", addr.Street, addr.City, addr.State, addr.Zip)
+		return ErrUnknownAddress
+	}
+
+	// 多个候选说明地址有歧义，DPV 匹配码不为 Y 说明门牌或单元号没有完全确认，
+	// 两种情况下使用第一个候选得到的 CMRA/RDI 都不一定可靠
+	addr.Candidates = len(results)
+	addr.LowConfidence = len(results) > 1 || candidate.Analysis.DPVMatchCode != "Y"
+	addr.CMRA = candidate.Analysis.DPVCMRACode
+	addr.RDI = candidate.Metadata.RDI
+	addr.Latitude = candidate.Metadata.Latitude
+	addr.Longitude = candidate.Metadata.Longitude
+	addr.County = candidate.Metadata.CountyName
+	addr.Vacant = candidate.Analysis.DPVVacantCode
+	addr.RecordType = candidate.Metadata.RecordType
+	addr.CongressionalDistrict = candidate.Metadata.CongressionalDistrict
+	return nil
+}
@@ -0,0 +1,194 @@
+package verify
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"atmb/model"
+
+	street "github.com/smartystreets/smartystreets-go-sdk/us-street-api"
+	"github.com/smartystreets/smartystreets-go-sdk/wireup"
+)
+
+// fakeSmarty 是测试用的 Smarty US Street API 服务。
+// resolve 按匹配策略和地址返回候选结果，返回 nil 的地址视为未知；
+// handle 不为空时在返回结果前调用，可以用来模拟延迟或打乱候选结果的顺序。
+type fakeSmarty struct {
+	resolve func(match street.MatchStrategy, lookup *street.Lookup) *street.Candidate
+	handle  func(r *http.Request, candidates []*street.Candidate) []*street.Candidate
+	// lookups 是收到的地址数量，每个匹配策略下的每个地址计一次
+	lookups atomic.Int64
+}
+
+// newFakeSmarty 启动 fake 服务，返回连接到该服务的客户端，测试结束时关闭服务
+func newFakeSmarty(t *testing.T, fake *fakeSmarty) *street.Client {
+	t.Helper()
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	return wireup.BuildUSStreetAPIClient(
+		wireup.SecretKeyCredential("test-id", "test-token"),
+		wireup.CustomBaseURL(srv.URL),
+		wireup.MaxRetry(0),
+	)
+}
+
+// ServeHTTP 按 SDK 的格式解析请求：单个地址使用 GET 查询参数，多个地址使用 POST JSON 数组
+func (f *fakeSmarty) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var lookups []*street.Lookup
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		lookups = []*street.Lookup{{
+			Street: q.Get("street"), Secondary: q.Get("secondary"), City: q.Get("city"), State: q.Get("state"),
+			ZIPCode: q.Get("zipcode"), InputID: q.Get("input_id"), MatchStrategy: street.MatchStrategy(q.Get("match")),
+		}}
+	} else if err := json.NewDecoder(r.Body).Decode(&lookups); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.lookups.Add(int64(len(lookups)))
+
+	candidates := []*street.Candidate{}
+	for i, lookup := range lookups {
+		match := lookup.MatchStrategy
+		if match == "" {
+			match = street.MatchStrict
+		}
+		if c := f.resolve(match, lookup); c != nil {
+			c.InputIndex, c.InputID = i, lookup.InputID
+			candidates = append(candidates, c)
+		}
+	}
+	if f.handle != nil {
+		candidates = f.handle(r, candidates)
+		if candidates == nil {
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(candidates)
+}
+
+// testCandidate 返回一个已确认的候选结果
+func testCandidate(cmra, rdi string) *street.Candidate {
+	c := &street.Candidate{}
+	c.Analysis.DPVMatchCode = "Y"
+	c.Analysis.DPVCMRACode = cmra
+	c.Metadata.RDI = rdi
+	return c
+}
+
+func TestVerifyBatchLookupsMatchChain(t *testing.T) {
+	fake := &fakeSmarty{resolve: func(match street.MatchStrategy, lookup *street.Lookup) *street.Candidate {
+		switch {
+		case lookup.Street == "1 Strict St":
+			return testCandidate("N", "Commercial")
+		case lookup.Street == "2 Enhanced St" && match == street.MatchEnhanced:
+			return testCandidate("Y", "Residential")
+		}
+		return nil
+	}}
+	verifier := SmartyVerifier{
+		Client:     newFakeSmarty(t, fake),
+		MatchChain: []street.MatchStrategy{street.MatchStrict, street.MatchEnhanced},
+	}
+	addrs := []*model.Address{
+		{Street: "1 Strict St", City: "Austin", State: "TX"},
+		{Street: "2 Enhanced St", City: "Austin", State: "TX"},
+		{Street: "3 Unknown St", City: "Austin", State: "TX"},
+	}
+
+	if got := verifier.LookupsPerAddress(); got != 2 {
+		t.Fatalf("LookupsPerAddress() = %d, want 2", got)
+	}
+	errs, lookups := verifier.VerifyBatchLookups(t.Context(), addrs)
+
+	// strict 下发送 3 个地址，enhanced 下只发送 strict 未找到的 2 个
+	if lookups != 5 || fake.lookups.Load() != 5 {
+		t.Errorf("lookups = %d (服务端收到 %d)，want 5", lookups, fake.lookups.Load())
+	}
+	wantTiers := []string{string(street.MatchStrict), string(street.MatchEnhanced), MatchUnverified}
+	for i, addr := range addrs {
+		if addr.MatchTier != wantTiers[i] {
+			t.Errorf("%s: MatchTier = %q, want %q", addr.Street, addr.MatchTier, wantTiers[i])
+		}
+	}
+	if errs[0] != nil || errs[1] != nil || !errors.Is(errs[2], ErrUnknownAddress) {
+		t.Errorf("errs = %v，want [nil nil ErrUnknownAddress]", errs)
+	}
+	if addrs[0].CMRA != "N" || addrs[1].CMRA != "Y" {
+		t.Errorf("CMRA = %q, %q，want N, Y", addrs[0].CMRA, addrs[1].CMRA)
+	}
+}
+
+func TestVerifyBatchTimeout(t *testing.T) {
+	fake := &fakeSmarty{
+		resolve: func(street.MatchStrategy, *street.Lookup) *street.Candidate { return testCandidate("N", "Commercial") },
+		// 响应前等待的时间远超过 BatchTimeout，客户端放弃请求后立即返回
+		handle: func(r *http.Request, candidates []*street.Candidate) []*street.Candidate {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+			return candidates
+		},
+	}
+	verifier := SmartyVerifier{Client: newFakeSmarty(t, fake), BatchTimeout: 50 * time.Millisecond}
+	addrs := []*model.Address{
+		{Street: "1 Main St", City: "Austin", State: "TX"},
+		{Street: "2 Main St", City: "Austin", State: "TX"},
+	}
+
+	start := time.Now()
+	errs := verifier.VerifyBatch(t.Context(), addrs)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("VerifyBatch 耗时 %v，没有在 BatchTimeout 到期后返回", elapsed)
+	}
+	for i, err := range errs {
+		if got := Classify(err); got != CategoryTimeout {
+			t.Errorf("errs[%d] 的类别 = %q，want %q (err = %v)", i, got, CategoryTimeout, err)
+		}
+		if !errors.Is(err, ErrTransient) {
+			t.Errorf("errs[%d] = %v，want 包装 ErrTransient", i, err)
+		}
+	}
+}
+
+func TestVerifyBatchOutOfOrderCandidates(t *testing.T) {
+	// 每个地址的 RDI 设为该地址的街道，便于检查结果是否写回了正确的地址
+	fake := &fakeSmarty{
+		resolve: func(_ street.MatchStrategy, lookup *street.Lookup) *street.Candidate {
+			return testCandidate("N", lookup.Street)
+		},
+		// 打乱候选结果的顺序，并让 InputIndex 指向其他地址，只有 InputID 是正确的
+		handle: func(_ *http.Request, candidates []*street.Candidate) []*street.Candidate {
+			slices.Reverse(candidates)
+			for i, c := range candidates {
+				c.InputIndex = i
+			}
+			return candidates
+		},
+	}
+	verifier := SmartyVerifier{Client: newFakeSmarty(t, fake)}
+	addrs := []*model.Address{
+		{Street: "1 Main St", City: "Austin", State: "TX"},
+		{Street: "2 Main St", City: "Austin", State: "TX"},
+		{Street: "3 Main St", City: "Austin", State: "TX"},
+		{Street: "4 Main St", City: "Austin", State: "TX"},
+	}
+
+	errs := verifier.VerifyBatch(t.Context(), addrs)
+	for i, addr := range addrs {
+		if errs[i] != nil {
+			t.Errorf("%s: err = %v", addr.Street, errs[i])
+		}
+		if addr.RDI != addr.Street || addr.Candidates != 1 {
+			t.Errorf("%s: RDI = %q, Candidates = %d，want 自己的结果 (%q, 1)", addr.Street, addr.RDI, addr.Candidates, addr.Street)
+		}
+	}
+}